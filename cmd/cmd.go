@@ -6,7 +6,9 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/JaneLiuL/fluentd-go/pkg/config"
 	"github.com/JaneLiuL/fluentd-go/pkg/plugin"
@@ -14,6 +16,9 @@ import (
 	yaml "gopkg.in/yaml.v3"
 )
 
+// drainTimeout stdin 读完后等待队列处理完的最长时间
+const drainTimeout = 30 * time.Second
+
 var (
 	positionFile string
 	configFile   string
@@ -54,66 +59,460 @@ func run(positionFile, path string) {
 	fluent := plugin.NewFluentd()
 
 	inputQueue := plugin.NewQueue(1000)
-	// filterQueue := plugin.NewQueue(1000)
-	outputQueue := plugin.NewQueue(1000)
+	fluent.AddQueue(inputQueue)
+
+	// stdin 输入读到 EOF 时关闭 eof，处理完所有事件后退出
+	eof := make(chan struct{})
+	var eofOnce sync.Once
+	oneShot := false
 
 	configFile, err := loadConfig(configFile)
 	if err != nil {
 		log.Fatalf("load config fail: %v", err)
 	}
 
-	for _, input := range configFile.Input {
+	for i, input := range configFile.Input {
+		var in plugin.InputPlugin
 		switch input.Type {
 		case "file":
-			fileInput := plugin.NewTailInput(input.Tag, inputQueue, input.Path, positionFile)
-			fluent.AddInput(fileInput)
+			in = plugin.NewTailInput(input.Tag, inputQueue, input.Path, positionFile)
 		case "tcp":
-			tcpInput := plugin.NewTcpInput(input.Tag, inputQueue, input.Address)
-			fluent.AddInput(tcpInput)
+			in = plugin.NewTcpInput(input.Tag, inputQueue, input.Address)
+		case "journald":
+			posFile := input.PosFile
+			if posFile == "" {
+				posFile = positionFile + ".journal"
+			}
+			in = plugin.NewJournaldInput(input.Tag, inputQueue, input.Path, input.Address, input.Command, posFile)
+		case "exec":
+			parser, err := newParser(input.ParserConfig)
+			if err != nil {
+				log.Fatalf("create parser for exec input fail: %v", err)
+			}
+			in = plugin.NewExecInput(input.Tag, inputQueue, input.Command, time.Duration(input.RunInterval)*time.Second, parser, input.StderrTag)
+		case "dummy":
+			dummyInput, err := plugin.NewDummyInput(input.Tag, inputQueue, input.Dummy, input.Rate, input.Size, input.Count, input.AutoIncrementKey)
+			if err != nil {
+				log.Fatalf("create dummy input fail: %v", err)
+			}
+			in = dummyInput
+		case "stdin":
+			parser, err := newParser(input.ParserConfig)
+			if err != nil {
+				log.Fatalf("create parser for stdin input fail: %v", err)
+			}
+			in = plugin.NewStdinInput(input.Tag, inputQueue, parser, func() {
+				eofOnce.Do(func() { close(eof) })
+			})
+			oneShot = true
 		default:
 			log.Printf("not support type: %s", input.Type)
+			continue
 		}
-	}
 
-	for _, filter := range configFile.Filters {
-		switch filter.Type {
-		case "match":
-			grepFilter := plugin.NewGrepFilter(inputQueue, outputQueue, filter.Tag, "message", filter.Pattern, false)
-			fluent.AddFilter(grepFilter)
-		case "exclude":
-			grepFilter := plugin.NewGrepFilter(inputQueue, outputQueue, filter.Tag, "message", filter.Pattern, true)
-			fluent.AddFilter(grepFilter)
+		if input.Inject != nil {
+			id := input.ID
+			if id == "" {
+				id = fmt.Sprintf("%s_%d", input.Type, i)
+			}
+			injector, err := newInjector(*input.Inject, input.Type, id)
+			if err != nil {
+				log.Fatalf("create inject for %s input fail: %v", input.Type, err)
+			}
+			in.(injectable).SetInjector(injector)
 		}
+		fluent.AddInput(in)
 	}
 
-	// transformFilter := plugin.NewRecordTransformerFilter(filterQueue, outputQueue, []string{"app.log", "network.log"},
-	// 	map[string]interface{}{"environment": "production", "source": "fluentd-go"},
-	// 	[]string{},
-	// )
-
-	// fluent.AddFilter(transformFilter)
+	// 过滤插件按配置顺序串联，前一个的输出队列是后一个的输入队列
+	outputQueue := inputQueue
+	for _, rule := range configFile.Filters {
+		nextQueue := plugin.NewQueue(1000)
+		fluent.AddQueue(nextQueue)
+		filter, err := newFilter(rule, outputQueue, nextQueue, inputQueue)
+		if err != nil {
+			log.Fatalf("create filter %s fail: %v", rule.Type, err)
+		}
+		if filter == nil {
+			log.Printf("not support filter type: %s", rule.Type)
+			continue
+		}
+		fluent.AddFilter(filter)
+		outputQueue = nextQueue
+	}
 
+	// 路由按输出插件的 tag 把事件分发到各自的队列，匹配多个输出时每个输出都会收到
+	router := plugin.NewRouter(outputQueue)
 	for _, outout := range configFile.Output {
+		routeQueue := plugin.NewQueue(1000)
+		var out plugin.OutputPlugin
 		switch outout.Type {
 		case "stdout":
-			stdoutOutput := plugin.NewStdoutOutput(outputQueue, outout.Tag, 10, 5)
-			fluent.AddOutput(stdoutOutput)
+			out = plugin.NewStdoutOutput(routeQueue, outout.Tag, 10, 5)
 		case "file":
-			fileOutput := plugin.NewFileOutput(outputQueue, outout.Tag, outout.Path, 10, 5, outout.Compression)
-			fluent.AddOutput(fileOutput)
+			out = plugin.NewFileOutput(routeQueue, outout.Tag, outout.Path, 10, 5, outout.Compression)
 		case "elasticsearch":
 			// TODO
+			continue
+		default:
+			log.Printf("not support output type: %s", outout.Type)
+			continue
 		}
+		if outout.Inject != nil {
+			injector, err := newInjector(*outout.Inject, "", "")
+			if err != nil {
+				log.Fatalf("create inject for %s output fail: %v", outout.Type, err)
+			}
+			out.(injectable).SetInjector(injector)
+		}
+		fluent.AddOutput(out)
+		fluent.AddQueue(routeQueue)
+		router.AddRoute(outout.Tag, routeQueue)
+	}
+	// 路由在所有过滤插件之后启动，在它们之后停止
+	fluent.AddFilter(router)
+	// 一次性管道不能丢事件，队列满时整条流水线都等待下游消费
+	if oneShot {
+		fluent.SetBlocking(true)
 	}
 	fluent.Start()
 	log.Println("Fluentd clone is running. Press Ctrl+C to stop.")
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	select {
+	case <-sigChan:
+	case <-eof:
+		if !fluent.Drain(drainTimeout) {
+			log.Printf("Timed out after %s waiting for queues to drain", drainTimeout)
+		}
+	}
 
 	fluent.Stop()
 	log.Println("Fluentd clone stopped.")
+
+	// 输出刷新失败、队列满丢弃了事件或有行解析失败时退出码非零
+	failed := false
+	if failures := fluent.Failures(); failures > 0 {
+		log.Printf("%d output flushes failed", failures)
+		failed = true
+	}
+	if dropped := fluent.Dropped(); dropped > 0 {
+		log.Printf("%d events were dropped because a queue was full", dropped)
+		failed = true
+	}
+	if parseErrors := fluent.ParseErrors(); parseErrors > 0 {
+		log.Printf("%d input lines could not be parsed", parseErrors)
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func newParser(cfg config.ParserConfig) (plugin.Parser, error) {
+	return plugin.NewParser(plugin.ParserOptions{
+		Format:      cfg.Format,
+		Expression:  cfg.Expression,
+		TimeKey:     cfg.TimeKey,
+		TimeFormat:  cfg.TimeFormat,
+		KeepTimeKey: cfg.KeepTimeKey,
+		Timezone:    cfg.Timezone,
+		Types:       cfg.Types,
+	})
+}
+
+// newFilter 创建过滤插件，emitQueue 为流水线入口，rewrite_tag 把重写后的事件放回这里
+func newFilter(rule config.FilterRule, inputQueue, outputQueue, emitQueue *plugin.Queue) (plugin.FilterPlugin, error) {
+	switch rule.Type {
+	case "match", "exclude":
+		if rule.Match == nil && (rule.Exclude == nil || rule.Exclude.Condition == nil) {
+			key := rule.Key
+			if key == "" {
+				key = "message"
+			}
+			grepRule := []plugin.GrepRule{{Key: key, Pattern: rule.Pattern}}
+			if rule.Type == "exclude" {
+				return plugin.NewGrepFilter(inputQueue, outputQueue, rule.Tag, plugin.GrepOptions{GrepRules: plugin.GrepRules{Exclude: grepRule}})
+			}
+			return plugin.NewGrepFilter(inputQueue, outputQueue, rule.Tag, plugin.GrepOptions{GrepRules: plugin.GrepRules{Regexp: grepRule}})
+		}
+		return newConditionFilter(rule, inputQueue, outputQueue)
+	case "grep":
+		top := config.GrepRules{Regexp: rule.Regexp}
+		if rule.Exclude != nil {
+			if rule.Exclude.Condition != nil {
+				return nil, fmt.Errorf("grep exclude must be a list of key/pattern rules")
+			}
+			top.Exclude = rule.Exclude.Rules
+		}
+		opts := plugin.GrepOptions{GrepRules: grepRules(top)}
+		for _, rules := range rule.And {
+			opts.And = append(opts.And, grepRules(rules))
+		}
+		for _, rules := range rule.Or {
+			opts.Or = append(opts.Or, grepRules(rules))
+		}
+		return plugin.NewGrepFilter(inputQueue, outputQueue, rule.Tag, opts)
+	case "record_transformer":
+		return plugin.NewRecordTransformerFilter(inputQueue, outputQueue, rule.Tag, plugin.RecordTransformerOptions{
+			Record:      rule.Record,
+			RemoveKeys:  rule.RemoveKeys,
+			RenewRecord: rule.RenewRecord,
+			KeepKeys:    rule.KeepKeys,
+		})
+	case "parser":
+		parser, err := newParser(rule.ParserConfig)
+		if err != nil {
+			return nil, err
+		}
+		return plugin.NewParserFilter(inputQueue, outputQueue, rule.Tag, plugin.ParserFilterOptions{
+			KeyName:            rule.Key,
+			Parser:             parser,
+			ReserveData:        rule.ReserveData,
+			ReserveTime:        rule.ReserveTime,
+			InjectKeyPrefix:    rule.InjectKeyPrefix,
+			HashValueField:     rule.HashValueField,
+			RemoveKeyNameField: rule.RemoveKeyNameField,
+		})
+	case "kubernetes_metadata":
+		return plugin.NewKubernetesMetadataFilter(inputQueue, outputQueue, rule.Tag, plugin.KubernetesMetadataOptions{
+			APIServer:          rule.KubernetesURL,
+			BearerTokenFile:    rule.BearerTokenFile,
+			CAFile:             rule.CAFile,
+			InsecureSkipVerify: rule.InsecureSkipVerify,
+			CacheTTL:           time.Duration(rule.CacheTTL) * time.Second,
+			Watch:              rule.Watch,
+			NodeName:           rule.NodeName,
+			TagPattern:         rule.TagPattern,
+			NamespaceKey:       rule.NamespaceKey,
+			PodKey:             rule.PodKey,
+		})
+	case "rewrite_tag":
+		opts := plugin.RewriteTagOptions{MaxRewrites: rule.MaxRewrites}
+		for _, r := range rule.Rules {
+			opts.Rules = append(opts.Rules, plugin.RewriteTagRule{Key: r.Key, Pattern: r.Pattern, Tag: r.Tag, Invert: r.Invert})
+		}
+		return plugin.NewRewriteTagFilter(inputQueue, outputQueue, emitQueue, rule.Tag, opts)
+	case "throttle":
+		return plugin.NewThrottleFilter(inputQueue, outputQueue, rule.Tag, plugin.ThrottleOptions{
+			GroupKeys:  rule.GroupKeys,
+			RateLimit:  rule.RateLimit,
+			Window:     time.Duration(rule.Window) * time.Second,
+			Action:     rule.Action,
+			RouteTag:   rule.RouteTag,
+			SummaryTag: rule.SummaryTag,
+			MaxGroups:  rule.MaxGroups,
+			GroupTTL:   time.Duration(rule.GroupTTL) * time.Second,
+		})
+	case "dedup":
+		return plugin.NewDedupFilter(inputQueue, outputQueue, rule.Tag, plugin.DedupOptions{
+			Keys:           rule.Keys,
+			Window:         time.Duration(rule.Window) * time.Second,
+			MaxEntries:     rule.MaxEntries,
+			RepeatCountKey: rule.RepeatCountKey,
+		})
+	case "sampling":
+		opts := plugin.SamplingOptions{
+			Rate:      rule.SampleRate,
+			Percent:   rule.SamplePercent,
+			GroupKeys: rule.GroupKeys,
+			HashKey:   rule.HashKey,
+			MaxGroups: rule.MaxGroups,
+		}
+		if rule.Keep != nil {
+			keep, err := plugin.NewCondition(conditionSpec(*rule.Keep))
+			if err != nil {
+				return nil, fmt.Errorf("keep: %v", err)
+			}
+			opts.Keep = keep
+		}
+		return plugin.NewSamplingFilter(inputQueue, outputQueue, rule.Tag, opts)
+	case "mask":
+		opts := plugin.MaskOptions{
+			Keys:      rule.Keys,
+			Detectors: rule.Detectors,
+			Method:    rule.Method,
+			Mask:      rule.Mask,
+			HMACKey:   rule.HMACKey,
+		}
+		for _, p := range rule.Patterns {
+			opts.Patterns = append(opts.Patterns, plugin.MaskPattern{Name: p.Name, Pattern: p.Pattern})
+		}
+		return plugin.NewMaskFilter(inputQueue, outputQueue, rule.Tag, opts)
+	case "types":
+		return plugin.NewTypesFilter(inputQueue, outputQueue, rule.Tag, plugin.TypesOptions{
+			Types:    rule.Types,
+			OnError:  rule.OnError,
+			ErrorTag: rule.ErrorTag,
+		})
+	case "event_time":
+		var formats []string
+		if rule.TimeFormat != "" || len(rule.TimeFormatFallbacks) > 0 {
+			formats = append([]string{rule.TimeFormat}, rule.TimeFormatFallbacks...)
+		}
+		return plugin.NewEventTimeFilter(inputQueue, outputQueue, rule.Tag, plugin.EventTimeOptions{
+			Key:      rule.TimeKey,
+			Formats:  formats,
+			Timezone: rule.Timezone,
+			KeepKey:  rule.KeepTimeKey,
+		})
+	case "concat":
+		return plugin.NewConcatFilter(inputQueue, outputQueue, rule.Tag, plugin.ConcatOptions{
+			Key:            rule.Key,
+			Separator:      rule.Separator,
+			StreamKeys:     rule.StreamKeys,
+			StartRegex:     rule.StartRegex,
+			ContinueRegex:  rule.ContinueRegex,
+			EndRegex:       rule.EndRegex,
+			PartialKey:     rule.PartialKey,
+			PartialValue:   rule.PartialValue,
+			KeepPartialKey: rule.KeepPartialKey,
+			FlushInterval:  time.Duration(rule.FlushInterval) * time.Second,
+			MaxSize:        rule.MaxSize,
+		})
+	case "script":
+		return plugin.NewScriptFilter(inputQueue, outputQueue, rule.Tag, plugin.ScriptOptions{
+			Path:    rule.Path,
+			Source:  rule.Source,
+			Call:    rule.Call,
+			Timeout: time.Duration(rule.TimeoutMs) * time.Millisecond,
+		})
+	case "wasm":
+		return plugin.NewWasmFilter(inputQueue, outputQueue, rule.Tag, plugin.WasmOptions{
+			Path:        rule.Path,
+			Format:      rule.Format,
+			MemoryLimit: rule.MemoryLimitMB * 1024 * 1024,
+			Timeout:     time.Duration(rule.TimeoutMs) * time.Millisecond,
+		})
+	case "aggregate":
+		return plugin.NewAggregateFilter(inputQueue, outputQueue, rule.Tag, plugin.AggregateOptions{
+			GroupKeys:   rule.GroupKeys,
+			Fields:      rule.Fields,
+			Percentiles: rule.Percentiles,
+			Buckets:     rule.Buckets,
+			Window:      time.Duration(rule.Window) * time.Second,
+			Tag:         rule.SummaryTag,
+			Passthrough: rule.Passthrough,
+			MaxGroups:   rule.MaxGroups,
+		})
+	case "geoip":
+		opts := plugin.GeoIPOptions{Path: rule.Path, Fields: rule.GeoIPFields, CacheSize: rule.CacheSize}
+		for _, l := range rule.Lookups {
+			opts.Lookups = append(opts.Lookups, plugin.GeoIPLookup{Key: l.Key, Target: l.Target})
+		}
+		if len(opts.Lookups) == 0 && rule.Key != "" {
+			opts.Lookups = []plugin.GeoIPLookup{{Key: rule.Key}}
+		}
+		return plugin.NewGeoIPFilter(inputQueue, outputQueue, rule.Tag, opts)
+	case "ua_parser":
+		return plugin.NewUAParserFilter(inputQueue, outputQueue, rule.Tag, plugin.UAParserOptions{
+			Key:         rule.Key,
+			Target:      rule.Target,
+			RegexesPath: rule.RegexesPath,
+			CacheSize:   rule.CacheSize,
+			DeleteKey:   rule.DeleteKey,
+		})
+	case "flatten":
+		return plugin.NewFlattenFilter(inputQueue, outputQueue, rule.Tag, plugin.FlattenOptions{
+			Separator: rule.Separator,
+			MaxDepth:  rule.MaxDepth,
+		})
+	case "unflatten":
+		return plugin.NewUnflattenFilter(inputQueue, outputQueue, rule.Tag, plugin.UnflattenOptions{
+			Separator: rule.Separator,
+			MaxDepth:  rule.MaxDepth,
+			Arrays:    rule.Arrays,
+		})
+	}
+	return nil, nil
+}
+
+// injectable 支持 inject 配置的输入和输出插件
+type injectable interface {
+	SetInjector(*plugin.Injector)
+}
+
+// newInjector 根据 inject 配置创建 Injector，输出插件的 inputType 和 inputID 为空
+func newInjector(cfg config.InjectConfig, inputType, inputID string) (*plugin.Injector, error) {
+	return plugin.NewInjector(plugin.InjectOptions{
+		HostnameKey:  cfg.HostnameKey,
+		Hostname:     cfg.Hostname,
+		InputTypeKey: cfg.InputTypeKey,
+		InputIDKey:   cfg.InputIDKey,
+		PathKey:      cfg.PathKey,
+		SourceIPKey:  cfg.SourceIPKey,
+		EventIDKey:   cfg.EventIDKey,
+	}, inputType, inputID)
+}
+
+// newConditionFilter 根据 match/exclude 字段条件创建过滤插件，pattern 作为 message 的正则条件合并进去
+func newConditionFilter(rule config.FilterRule, inputQueue, outputQueue *plugin.Queue) (plugin.FilterPlugin, error) {
+	var matchSpec, excludeSpec *plugin.ConditionSpec
+	if rule.Match != nil {
+		spec := conditionSpec(*rule.Match)
+		matchSpec = &spec
+	}
+	if rule.Exclude != nil && rule.Exclude.Condition != nil {
+		spec := conditionSpec(*rule.Exclude.Condition)
+		excludeSpec = &spec
+	}
+	if rule.Pattern != "" {
+		key := rule.Key
+		if key == "" {
+			key = "message"
+		}
+		patternSpec := plugin.ConditionSpec{Fields: map[string]string{key: "~" + rule.Pattern}}
+		if rule.Type == "exclude" {
+			if excludeSpec == nil {
+				excludeSpec = &patternSpec
+			} else {
+				excludeSpec = &plugin.ConditionSpec{Or: []plugin.ConditionSpec{*excludeSpec, patternSpec}}
+			}
+		} else {
+			if matchSpec == nil {
+				matchSpec = &patternSpec
+			} else {
+				matchSpec.And = append(matchSpec.And, patternSpec)
+			}
+		}
+	}
+
+	var match, exclude *plugin.Condition
+	var err error
+	if matchSpec != nil {
+		if match, err = plugin.NewCondition(*matchSpec); err != nil {
+			return nil, fmt.Errorf("match: %v", err)
+		}
+	}
+	if excludeSpec != nil {
+		if exclude, err = plugin.NewCondition(*excludeSpec); err != nil {
+			return nil, fmt.Errorf("exclude: %v", err)
+		}
+	}
+	return plugin.NewConditionFilter(inputQueue, outputQueue, rule.Tag, match, exclude), nil
+}
+
+func grepRules(rules config.GrepRules) plugin.GrepRules {
+	var result plugin.GrepRules
+	for _, rule := range rules.Regexp {
+		result.Regexp = append(result.Regexp, plugin.GrepRule{Key: rule.Key, Pattern: rule.Pattern})
+	}
+	for _, rule := range rules.Exclude {
+		result.Exclude = append(result.Exclude, plugin.GrepRule{Key: rule.Key, Pattern: rule.Pattern})
+	}
+	return result
+}
+
+func conditionSpec(cond config.Condition) plugin.ConditionSpec {
+	spec := plugin.ConditionSpec{Fields: cond.Fields}
+	for _, sub := range cond.And {
+		spec.And = append(spec.And, conditionSpec(sub))
+	}
+	for _, sub := range cond.Or {
+		spec.Or = append(spec.Or, conditionSpec(sub))
+	}
+	return spec
 }
 
 func loadConfig(path string) (*config.Config, error) {
@@ -3,11 +3,19 @@ module github.com/JaneLiuL/fluentd-go
 go 1.25.0
 
 require (
+	github.com/oschwald/maxminddb-golang/v2 v2.6.0
 	github.com/spf13/cobra v1.10.1
+	github.com/tetratelabs/wazero v1.12.0
+	github.com/ua-parser/uap-go v0.0.0-20260529044130-17c35e68e58c
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	github.com/yuin/gopher-lua v1.1.2
 	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
+	github.com/hashicorp/golang-lru v1.0.2 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.9 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	golang.org/x/sys v0.47.0 // indirect
 )
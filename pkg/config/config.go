@@ -1,5 +1,7 @@
 package config
 
+import yaml "gopkg.in/yaml.v3"
+
 type Config struct {
 	Input   []InputConfig  `yaml:"inputs"`
 	Filters []FilterRule   `yaml:"filters"`
@@ -8,51 +10,383 @@ type Config struct {
 
 // inputs:
 //   - type: file
+//     id: app_log
 //     path: /var/log/app.log
 //     tag: application
 //     format: json
+//     inject: {hostname_key: host, input_type_key: $.agent.input, input_id_key: $.agent.id, path_key: file, event_id_key: event_id}
+//   - type: file
+//     path: /var/log/containers/web-7d4b9_default_nginx-0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef.log
+//     tag: kubernetes.*
+//   - type: tcp
+//     address: 0.0.0.0:5170
+//     tag: forward
+//     inject: {hostname_key: host, source_ip_key: source_ip}
+//   - type: journald
+//     command: journalctl -o export --follow
+//     tag: journal
+//     pos_file: /tmp/journal.pos
+//   - type: exec
+//     command: df -P /
+//     run_interval: 60
+//     tag: disk
+//     format: regex
+//     expression: '^(?P<filesystem>\S+)\s+(?P<blocks>\d+)'
+//   - type: dummy
+//     tag: test.web
+//     rate: 100
+//     dummy: [{message: "GET /api/users/${counter}", status: "${choice:200|404|500}", latency_ms: "${random:1:500}"}]
 type InputConfig struct {
-	Type    string `yaml:"type"`
-	Path    string `yaml:"path"`
-	Tag     string `yaml:"tag"`
-	Format  string `yaml:"format"`
-	Address string `yaml:"address"`
+	Type         string `yaml:"type"`
+	Path         string `yaml:"path"`
+	Tag          string `yaml:"tag"`
+	ParserConfig `yaml:",inline"`
+	Address      string `yaml:"address"`
+	Command      string `yaml:"command"`
+	PosFile      string `yaml:"pos_file"`
+	RunInterval  int    `yaml:"run_interval"`
+	StderrTag    string `yaml:"stderr_tag"`
+
+	// dummy
+	Dummy            []map[string]interface{} `yaml:"dummy"`
+	Rate             float64                  `yaml:"rate"`
+	Size             int                      `yaml:"size"`
+	Count            int64                    `yaml:"count"`
+	AutoIncrementKey string                   `yaml:"auto_increment_key"`
+
+	// ID 输入插件的 ID，为空时为 <type>_<序号>，inject 的 input_id_key 写入这个值
+	ID     string        `yaml:"id"`
+	Inject *InjectConfig `yaml:"inject"`
+}
+
+// InjectConfig 向事件写入元数据的配置，每一项是写入的字段名，为空的项不写入。
+// 输出插件只支持 hostname_key 和 event_id_key
+type InjectConfig struct {
+	HostnameKey  string `yaml:"hostname_key"`
+	Hostname     string `yaml:"hostname"`
+	InputTypeKey string `yaml:"input_type_key"`
+	InputIDKey   string `yaml:"input_id_key"`
+	PathKey      string `yaml:"path_key"`
+	SourceIPKey  string `yaml:"source_ip_key"`
+	EventIDKey   string `yaml:"event_id_key"`
+}
+
+// ParserConfig 解析器配置，format 为 none、json、regex、logfmt 或 ltsv，
+// time_format 可以是 unix、unix_ms、unix_us、unix_ns、strptime 格式 (%Y-%m-%d %H:%M:%S) 或 Go 时间布局，
+// types 为字段类型，例如 {status: integer, tags: "array:|"}
+type ParserConfig struct {
+	Format      string            `yaml:"format"`
+	Expression  string            `yaml:"expression"`
+	TimeKey     string            `yaml:"time_key"`
+	TimeFormat  string            `yaml:"time_format"`
+	KeepTimeKey bool              `yaml:"keep_time_key"`
+	Timezone    string            `yaml:"timezone"`
+	Types       map[string]string `yaml:"types"`
 }
 
 // outputs:
 //   - type: stdout
 //     tag: ""
+//   - type: file
+//     tag: "**"
+//     path: /var/log/fluentd-go/out
+//     inject: {hostname_key: aggregator}
 type OutputConfig struct {
-	Type        string `yaml:"type"`
-	Path        string `yaml:"path"`
-	Tag         string `yaml:"tag"`
-	Address     string `yaml:"address"`
-	Compression bool   `yaml:"compression"`
+	Type        string        `yaml:"type"`
+	Path        string        `yaml:"path"`
+	Tag         string        `yaml:"tag"`
+	Address     string        `yaml:"address"`
+	Compression bool          `yaml:"compression"`
+	Inject      *InjectConfig `yaml:"inject"`
 }
 
 // filters:
-//   - type: execlude
+//   - type: exclude
 //     tag: application
-//     match:
-//     execlude: "in ERROR,WARN"
+//     exclude: {level: "in DEBUG,TRACE"}
 //   - type: match
 //     tag: application
-//     match:
-//     response_time: ">1.0"
+//     match: {response_time: ">1.0", user_id: exists}
 //   - type: match
 //     tag: network
-//     match:
-//     message: "~error|failed|critical"
+//     match: {or: [{message: "~error|failed|critical"}, {status: ">=500"}]}
+//   - type: grep
+//     tag: app.**
+//     regexp: [{key: $.kubernetes.labels.app, pattern: "^web$"}]
+//     exclude: [{key: status, pattern: "/^2\\d\\d$/"}]
+//     or: [{regexp: [{key: level, pattern: ERROR}, {key: message, pattern: panic}]}]
+//   - type: record_transformer
+//     tag: app.**
+//     record: {service: "${tag_parts[1]}", host: "${hostname}", user_id: '${record["user"]["id"]}', slow: "${record.latency > 1000}"}
+//     remove_keys: [$.user.password]
+//   - type: parser
+//     tag: docker.**
+//     key: log
+//     format: json
+//     time_key: time
+//     reserve_data: true
+//     remove_key_name_field: true
+//   - type: kubernetes_metadata
+//     tag: kubernetes.**
+//     kubernetes_url: https://kubernetes.default.svc
+//     cache_ttl: 3600
+//     watch: true
+//   - type: rewrite_tag
+//     tag: app.**
+//     rules: [{key: level, pattern: "^(ERROR|FATAL)$", tag: "alert.$1.${tag_parts[1]}"}]
+//   - type: throttle
+//     tag: kubernetes.**
+//     group_keys: [$.kubernetes.namespace_name]
+//     rate_limit: 1000
+//     window: 60
+//     action: route
+//     route_tag: throttled
+//   - type: dedup
+//     tag: app.**
+//     keys: [message, $.request.id]
+//     window: 10
+//     repeat_count_key: repeat_count
+//   - type: sampling
+//     tag: app.**
+//     sample_percent: 10
+//     hash_key: trace_id
+//     keep: {level: "in ERROR,FATAL"}
+//   - type: mask
+//     tag: app.**
+//     detectors: [email, credit_card, ip]
+//     patterns: [{name: ssn, pattern: '\d{3}-\d{2}-\d{4}'}]
+//     method: hash
+//     hmac_key: secret
+//   - type: types
+//     tag: app.**
+//     types: {status: integer, latency: float, ok: bool, ts: "time:2006-01-02 15:04:05", tags: "array:|"}
+//     on_error: route
+//     error_tag: app.type_error
+//   - type: event_time
+//     tag: replay.**
+//     time_key: timestamp
+//     time_format: "%d/%b/%Y:%H:%M:%S %z"
+//     time_format_fallbacks: [unix_ms]
+//     timezone: Asia/Shanghai
+//   - type: concat
+//     tag: docker.**
+//     key: log
+//     stream_keys: [container_id]
+//     partial_key: partial_message
+//   - type: concat
+//     tag: java.**
+//     start_regex: '^\d{4}-\d{2}-\d{2}'
+//     flush_interval: 5
+//   - type: script
+//     tag: app.**
+//     path: /etc/fluentd-go/filter.lua
+//     call: filter
+//     timeout_ms: 100
+//   - type: wasm
+//     tag: app.**
+//     path: /etc/fluentd-go/filter.wasm
+//     format: msgpack
+//     memory_limit_mb: 32
+//     timeout_ms: 50
+//   - type: aggregate
+//     tag: nginx.access
+//     group_keys: [route, status]
+//     fields: [latency_ms]
+//     percentiles: [50, 95, 99]
+//     buckets: [10, 50, 100, 500]
+//     window: 60
+//     summary_tag: metrics.nginx
+//   - type: geoip
+//     tag: nginx.access
+//     path: /usr/share/GeoIP/GeoLite2-City.mmdb
+//     lookups: [{key: remote_addr, target: $.geo.client}, {key: $.upstream.addr, target: $.geo.upstream}]
+//     geoip_fields: {country: country.iso_code, city: city.names.en, region: subdivisions.0.names.en, $.location.lat: location.latitude, $.location.lon: location.longitude}
+//     cache_size: 50000
+//   - type: ua_parser
+//     tag: nginx.access
+//     key: http_user_agent
+//     target: $.client.ua
+//     delete_key: true
+//   - type: flatten
+//     tag: splunk.**
+//     separator: "_"
+//     max_depth: 3
+//   - type: unflatten
+//     tag: otlp.**
+//     arrays: true
 type FilterRule struct {
 	Type    string `yaml:"type"`
 	Tag     string `yaml:"tag"`
 	Pattern string `yaml:"pattern"`
-	// Exclude map[string]string `yaml:"exclude"`
+
+	// match/exclude 类型的 pattern 作用的字段，默认为 message
+	Key string `yaml:"key"`
+
+	// match/exclude 字段条件，满足 match 且不满足 exclude 的事件被保留
+	Match   *Condition `yaml:"match"`
+	Exclude *Exclude   `yaml:"exclude"`
+
+	// grep
+	Regexp []GrepRule  `yaml:"regexp"`
+	And    []GrepRules `yaml:"and"`
+	Or     []GrepRules `yaml:"or"`
+
+	// record_transformer
+	Record      map[string]interface{} `yaml:"record"`
+	RemoveKeys  []string               `yaml:"remove_keys"`
+	KeepKeys    []string               `yaml:"keep_keys"`
+	RenewRecord bool                   `yaml:"renew_record"`
+
+	// parser，key 为要解析的字段
+	ParserConfig       `yaml:",inline"`
+	ReserveData        bool   `yaml:"reserve_data"`
+	ReserveTime        bool   `yaml:"reserve_time"`
+	InjectKeyPrefix    string `yaml:"inject_key_prefix"`
+	HashValueField     string `yaml:"hash_value_field"`
+	RemoveKeyNameField bool   `yaml:"remove_key_name_field"`
+
+	// kubernetes_metadata
+	KubernetesURL      string `yaml:"kubernetes_url"`
+	BearerTokenFile    string `yaml:"bearer_token_file"`
+	CAFile             string `yaml:"ca_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	CacheTTL           int    `yaml:"cache_ttl"`
+	Watch              bool   `yaml:"watch"`
+	NodeName           string `yaml:"node_name"`
+	TagPattern         string `yaml:"tag_pattern"`
+	NamespaceKey       string `yaml:"namespace_key"`
+	PodKey             string `yaml:"pod_key"`
+
+	// rewrite_tag
+	Rules       []RewriteTagRule `yaml:"rules"`
+	MaxRewrites int              `yaml:"max_rewrites"`
+
+	// throttle，window 和 group_ttl 的单位为秒
+	GroupKeys  []string `yaml:"group_keys"`
+	RateLimit  int      `yaml:"rate_limit"`
+	Window     int      `yaml:"window"`
+	Action     string   `yaml:"action"`
+	RouteTag   string   `yaml:"route_tag"`
+	SummaryTag string   `yaml:"summary_tag"`
+	MaxGroups  int      `yaml:"max_groups"`
+	GroupTTL   int      `yaml:"group_ttl"`
+
+	// dedup，keys 为空时使用整条记录，window 与 throttle 共用
+	Keys           []string `yaml:"keys"`
+	MaxEntries     int      `yaml:"max_entries"`
+	RepeatCountKey string   `yaml:"repeat_count_key"`
+
+	// sampling，group_keys 和 max_groups 与 throttle 共用
+	SampleRate    int        `yaml:"sample_rate"`
+	SamplePercent float64    `yaml:"sample_percent"`
+	HashKey       string     `yaml:"hash_key"`
+	Keep          *Condition `yaml:"keep"`
+
+	// mask，keys 与 dedup 共用，为空时检查整条记录
+	Detectors []string      `yaml:"detectors"`
+	Patterns  []MaskPattern `yaml:"patterns"`
+	Method    string        `yaml:"method"`
+	Mask      string        `yaml:"mask"`
+	HMACKey   string        `yaml:"hmac_key"`
+
+	// types，字段类型使用 ParserConfig 中的 types
+	OnError  string `yaml:"on_error"`
+	ErrorTag string `yaml:"error_tag"`
+
+	// event_time，使用 ParserConfig 中的 time_key、time_format、timezone 和 keep_time_key
+	TimeFormatFallbacks []string `yaml:"time_format_fallbacks"`
+
+	// concat，key 为要拼接的字段，flush_interval 的单位为秒
+	Separator      string   `yaml:"separator"`
+	StreamKeys     []string `yaml:"stream_keys"`
+	StartRegex     string   `yaml:"start_regex"`
+	ContinueRegex  string   `yaml:"continue_regex"`
+	EndRegex       string   `yaml:"end_regex"`
+	PartialKey     string   `yaml:"partial_key"`
+	PartialValue   string   `yaml:"partial_value"`
+	KeepPartialKey bool     `yaml:"keep_partial_key"`
+	FlushInterval  int      `yaml:"flush_interval"`
+	MaxSize        int      `yaml:"max_size"`
+
+	// script，path 和 source 二选一
+	Path      string `yaml:"path"`
+	Source    string `yaml:"source"`
+	Call      string `yaml:"call"`
+	TimeoutMs int    `yaml:"timeout_ms"`
+
+	// wasm，path 和 timeout_ms 与 script 共用，format 为 json 或 msgpack
+	MemoryLimitMB int `yaml:"memory_limit_mb"`
+
+	// aggregate，group_keys、window、summary_tag 和 max_groups 与 throttle 共用
+	Fields      []string  `yaml:"fields"`
+	Percentiles []float64 `yaml:"percentiles"`
+	Buckets     []float64 `yaml:"buckets"`
+	Passthrough bool      `yaml:"passthrough"`
+
+	// geoip，path 与 script 共用，只查询一个字段时也可以只写 key，结果写入 geoip
+	Lookups     []GeoIPLookup     `yaml:"lookups"`
+	GeoIPFields map[string]string `yaml:"geoip_fields"`
+	CacheSize   int               `yaml:"cache_size"`
+
+	// ua_parser，key 为要解析的字段，cache_size 与 geoip 共用，regexes_path 为空时使用内置的 uap-core 规则
+	Target      string `yaml:"target"`
+	RegexesPath string `yaml:"regexes_path"`
+	DeleteKey   bool   `yaml:"delete_key"`
+
+	// flatten 和 unflatten，separator 与 concat 共用，默认为 .
+	MaxDepth int  `yaml:"max_depth"`
+	Arrays   bool `yaml:"arrays"`
+}
+
+// Condition 字段条件，字段之间为且的关系，and 中的子条件都要满足，or 中至少一个子条件满足
+type Condition struct {
+	Fields map[string]string `yaml:",inline"`
+	And    []Condition       `yaml:"and"`
+	Or     []Condition       `yaml:"or"`
+}
+
+// GrepRule grep 过滤插件的一条规则
+type GrepRule struct {
+	Key     string `yaml:"key"`
+	Pattern string `yaml:"pattern"`
+}
+
+// GrepRules grep 过滤插件 and/or 中的一组规则
+type GrepRules struct {
+	Regexp  []GrepRule `yaml:"regexp"`
+	Exclude []GrepRule `yaml:"exclude"`
 }
 
-// type Filter struct {
-// 	Type    string            `yaml:"type"`
-// 	Tag     string            `yaml:"tag"`
-// 	Match   map[string]string `yaml:"match"`
-// 	Exclude map[string]string `yaml:"exclude"`
-// }
+// RewriteTagRule rewrite_tag 过滤插件的一条规则
+type RewriteTagRule struct {
+	Key     string `yaml:"key"`
+	Pattern string `yaml:"pattern"`
+	Tag     string `yaml:"tag"`
+	Invert  bool   `yaml:"invert"`
+}
+
+// MaskPattern mask 过滤插件的自定义检测器
+type MaskPattern struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+}
+
+// Exclude 在 match/exclude 类型中是字段条件，在 grep 类型中是规则列表
+type Exclude struct {
+	Condition *Condition
+	Rules     []GrepRule
+}
+
+func (e *Exclude) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.SequenceNode {
+		return node.Decode(&e.Rules)
+	}
+	e.Condition = &Condition{}
+	return node.Decode(e.Condition)
+}
+
+// GeoIPLookup geoip 过滤插件要查询的一个 IP 字段
+type GeoIPLookup struct {
+	Key    string `yaml:"key"`
+	Target string `yaml:"target"`
+}
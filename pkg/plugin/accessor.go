@@ -0,0 +1,215 @@
+package plugin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RecordAccessor 按路径读写记录中的嵌套字段，语法与 Fluentd 的 record_accessor 一致：
+//
+//	message           顶层字段 message (不以 $ 开头时整个字符串就是字段名)
+//	$.a.b             嵌套字段 a -> b
+//	$.a.b[0]          数组的第一个元素，负数下标从末尾开始
+//	$['a.b']['c']     字段名中包含点号时使用括号语法
+type RecordAccessor struct {
+	key  string
+	path []accessorStep
+}
+
+type accessorStep struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// NewRecordAccessor 解析字段路径
+func NewRecordAccessor(key string) (*RecordAccessor, error) {
+	if !strings.HasPrefix(key, "$") {
+		if key == "" {
+			return nil, fmt.Errorf("empty record key")
+		}
+		return &RecordAccessor{key: key, path: []accessorStep{{key: key}}}, nil
+	}
+
+	path, err := parseAccessorPath(key[1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid record accessor %q: %v", key, err)
+	}
+	if len(path) == 0 {
+		return nil, fmt.Errorf("invalid record accessor %q: empty path", key)
+	}
+	return &RecordAccessor{key: key, path: path}, nil
+}
+
+func parseAccessorPath(s string) ([]accessorStep, error) {
+	var path []accessorStep
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '.':
+			i++
+			start := i
+			for i < len(s) && s[i] != '.' && s[i] != '[' {
+				i++
+			}
+			if i == start {
+				return nil, fmt.Errorf("empty key at offset %d", start)
+			}
+			path = append(path, accessorStep{key: s[start:i]})
+		case '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed bracket at offset %d", i)
+			}
+			inner := strings.TrimSpace(s[i+1 : i+end])
+			i += end + 1
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				path = append(path, accessorStep{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			index, err := strconv.Atoi(inner)
+			if err != nil {
+				return nil, fmt.Errorf("invalid index %q", inner)
+			}
+			path = append(path, accessorStep{index: index, isIndex: true})
+		default:
+			return nil, fmt.Errorf("unexpected %q at offset %d", s[i], i)
+		}
+	}
+	return path, nil
+}
+
+// String 返回原始的字段路径
+func (a *RecordAccessor) String() string {
+	return a.key
+}
+
+// Get 读取字段值，路径不存在时返回 false
+func (a *RecordAccessor) Get(record map[string]interface{}) (interface{}, bool) {
+	var current interface{} = record
+	for _, step := range a.path {
+		next, ok := step.get(current)
+		if !ok {
+			return nil, false
+		}
+		current = next
+	}
+	return current, true
+}
+
+// Set 写入字段值，缺少的中间层级会创建为 map，路径中间不是 map 或数组下标越界时返回错误
+func (a *RecordAccessor) Set(record map[string]interface{}, value interface{}) error {
+	var current interface{} = record
+	for i, step := range a.path {
+		last := i == len(a.path)-1
+
+		if step.isIndex {
+			list, ok := current.([]interface{})
+			if !ok {
+				return fmt.Errorf("%s: not an array", a.key)
+			}
+			index, ok := step.resolveIndex(len(list))
+			if !ok {
+				return fmt.Errorf("%s: index %d out of range", a.key, step.index)
+			}
+			if last {
+				list[index] = value
+				return nil
+			}
+			current = list[index]
+			continue
+		}
+
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: not a map", a.key)
+		}
+		if last {
+			m[step.key] = value
+			return nil
+		}
+		next, exists := m[step.key]
+		if !exists || next == nil {
+			next = make(map[string]interface{})
+			m[step.key] = next
+		}
+		current = next
+	}
+	return nil
+}
+
+// Delete 删除字段，返回字段是否存在。删除数组元素时后面的元素前移
+func (a *RecordAccessor) Delete(record map[string]interface{}) bool {
+	var parent interface{} = record
+	var grandparent interface{}
+	var parentStep accessorStep
+	for i, step := range a.path {
+		if i == len(a.path)-1 {
+			if step.isIndex {
+				list, ok := parent.([]interface{})
+				if !ok {
+					return false
+				}
+				index, ok := step.resolveIndex(len(list))
+				if !ok {
+					return false
+				}
+				// 切片长度改变，需要写回上一层
+				updated := append(list[:index:index], list[index+1:]...)
+				switch gp := grandparent.(type) {
+				case map[string]interface{}:
+					gp[parentStep.key] = updated
+				case []interface{}:
+					if gi, ok := parentStep.resolveIndex(len(gp)); ok {
+						gp[gi] = updated
+					}
+				}
+				return true
+			}
+			m, ok := parent.(map[string]interface{})
+			if !ok {
+				return false
+			}
+			if _, exists := m[step.key]; !exists {
+				return false
+			}
+			delete(m, step.key)
+			return true
+		}
+
+		next, ok := step.get(parent)
+		if !ok {
+			return false
+		}
+		grandparent, parentStep, parent = parent, step, next
+	}
+	return false
+}
+
+func (s accessorStep) get(current interface{}) (interface{}, bool) {
+	if s.isIndex {
+		list, ok := current.([]interface{})
+		if !ok {
+			return nil, false
+		}
+		index, ok := s.resolveIndex(len(list))
+		if !ok {
+			return nil, false
+		}
+		return list[index], true
+	}
+	m, ok := current.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	value, ok := m[s.key]
+	return value, ok
+}
+
+func (s accessorStep) resolveIndex(length int) (int, bool) {
+	index := s.index
+	if index < 0 {
+		index += length
+	}
+	return index, index >= 0 && index < length
+}
@@ -0,0 +1,342 @@
+package plugin
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultAggregateTag 汇总事件的默认标签
+	DefaultAggregateTag = "fluentd.aggregate"
+	// aggregateMaxSamples 每个分组每个字段保留用于计算百分位数的最多样本数
+	aggregateMaxSamples = 10000
+)
+
+// aggregateSummaryFields 汇总事件中固定的顶层字段，分组字段不能与它们同名
+var aggregateSummaryFields = []string{"window_start", "window_end", "count", "stats"}
+
+// AggregateOptions aggregate 过滤插件的配置
+type AggregateOptions struct {
+	// GroupKeys 分组字段，支持 record accessor 语法，为空时所有事件属于同一组
+	GroupKeys []string
+	// Fields 要统计的数值字段，统计 count、sum、min、max、avg 和 Percentiles
+	Fields []string
+	// Percentiles 要计算的百分位数，例如 [50, 95, 99]
+	Percentiles []float64
+	// Buckets 直方图的上界，每个桶统计小于等于上界的值的个数
+	Buckets []float64
+	// Window 滚动窗口的长度，按墙上时间对齐，默认 60 秒
+	Window time.Duration
+	// Tag 汇总事件的标签，默认为 DefaultAggregateTag
+	Tag string
+	// Passthrough 为 true 时原事件继续传递，否则只发出汇总事件
+	Passthrough bool
+	// MaxGroups 一个窗口内最多的分组数，超过后新分组的事件不参与统计
+	MaxGroups int
+}
+
+// AggregateFilter 把日志转换为指标：每个窗口结束时为每个分组发出一个汇总事件，
+// 包含分组字段、窗口起止时间、事件数 count，每个数值字段的统计按字段路径写在 stats 下，例如
+//
+//	{route: /api, window_start, window_end, count: 10, stats: {latency_ms: {count, sum, min, max, avg, p99}}}
+type AggregateFilter struct {
+	*BaseFilter
+	groupKeys   []*RecordAccessor
+	fields      []*RecordAccessor
+	percentiles []float64
+	buckets     []float64
+	window      time.Duration
+	tag         string
+	passthrough bool
+	maxGroups   int
+
+	groupsMu    sync.Mutex
+	groups      map[string]*aggregateGroup
+	order       []string
+	windowStart time.Time
+	overflow    int64
+	stop        chan struct{}
+}
+
+type aggregateGroup struct {
+	values map[*RecordAccessor]interface{}
+	count  int64
+	fields []*aggregateField
+}
+
+type aggregateField struct {
+	count   int64
+	sum     float64
+	min     float64
+	max     float64
+	samples []float64
+	buckets []int64
+}
+
+// NewAggregateFilter 创建一个新的聚合过滤插件
+func NewAggregateFilter(inputQueue, outputQueue *Queue, matchTag string, opts AggregateOptions) (*AggregateFilter, error) {
+	if opts.Window <= 0 {
+		opts.Window = time.Minute
+	}
+	if opts.Tag == "" {
+		opts.Tag = DefaultAggregateTag
+	}
+	if opts.MaxGroups <= 0 {
+		opts.MaxGroups = DefaultThrottleMaxGroups
+	}
+	for _, p := range opts.Percentiles {
+		if p <= 0 || p > 100 {
+			return nil, fmt.Errorf("invalid percentile %g", p)
+		}
+	}
+	buckets := append([]float64(nil), opts.Buckets...)
+	sort.Float64s(buckets)
+
+	a := &AggregateFilter{
+		BaseFilter:  NewBaseFilter(inputQueue, outputQueue, matchTag),
+		percentiles: opts.Percentiles,
+		buckets:     buckets,
+		window:      opts.Window,
+		tag:         opts.Tag,
+		passthrough: opts.Passthrough,
+		maxGroups:   opts.MaxGroups,
+		groups:      make(map[string]*aggregateGroup),
+		windowStart: time.Now().Truncate(opts.Window),
+	}
+	for _, key := range opts.GroupKeys {
+		accessor, err := NewRecordAccessor(key)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range aggregateSummaryFields {
+			if accessor.path[0].key == name {
+				return nil, fmt.Errorf("group key %s conflicts with the summary field %s", key, name)
+			}
+		}
+		a.groupKeys = append(a.groupKeys, accessor)
+	}
+	for _, key := range opts.Fields {
+		accessor, err := NewRecordAccessor(key)
+		if err != nil {
+			return nil, err
+		}
+		a.fields = append(a.fields, accessor)
+	}
+	return a, nil
+}
+
+// Filter 执行过滤操作
+func (a *AggregateFilter) Filter(event *Event) *Event {
+	values := make(map[*RecordAccessor]interface{}, len(a.groupKeys))
+	parts := make([]string, len(a.groupKeys))
+	for i, key := range a.groupKeys {
+		value, _ := key.Get(event.Record)
+		values[key] = value
+		parts[i] = toString(value)
+	}
+	groupKey := strings.Join(parts, "\x00")
+
+	a.groupsMu.Lock()
+	a.rollWindow(time.Now())
+	group := a.groups[groupKey]
+	if group == nil && len(a.groups) < a.maxGroups {
+		group = &aggregateGroup{values: values, fields: make([]*aggregateField, len(a.fields))}
+		for i := range group.fields {
+			group.fields[i] = &aggregateField{min: math.Inf(1), max: math.Inf(-1), buckets: make([]int64, len(a.buckets)+1)}
+		}
+		a.groups[groupKey] = group
+		a.order = append(a.order, groupKey)
+	}
+	if group != nil {
+		a.add(group, event.Record)
+	} else {
+		a.overflow++
+	}
+	a.groupsMu.Unlock()
+
+	if a.passthrough {
+		return event
+	}
+	return nil
+}
+
+func (a *AggregateFilter) add(group *aggregateGroup, record map[string]interface{}) {
+	group.count++
+	for i, key := range a.fields {
+		value, ok := key.Get(record)
+		if !ok {
+			continue
+		}
+		n, ok := toNumber(value)
+		if !ok || math.IsNaN(n) {
+			continue
+		}
+		f := group.fields[i]
+		f.count++
+		f.sum += n
+		f.min = math.Min(f.min, n)
+		f.max = math.Max(f.max, n)
+		if len(a.percentiles) > 0 {
+			// 超过样本上限后使用水塘抽样，内存有界
+			if len(f.samples) < aggregateMaxSamples {
+				f.samples = append(f.samples, n)
+			} else if j := rand.Int63n(f.count); j < aggregateMaxSamples {
+				f.samples[j] = n
+			}
+		}
+		f.buckets[sort.SearchFloat64s(a.buckets, n)]++
+	}
+}
+
+// rollWindow 当前窗口结束时发出所有分组的汇总事件并开始新窗口
+func (a *AggregateFilter) rollWindow(now time.Time) {
+	if now.Before(a.windowStart.Add(a.window)) {
+		return
+	}
+	a.flush(a.windowStart.Add(a.window))
+	a.windowStart = now.Truncate(a.window)
+}
+
+// flush 发出当前窗口的汇总事件，end 为窗口结束时间。分组数可能超过输出队列的容量，
+// 队列满时等待下游消费，最多等待一个窗口的时间
+func (a *AggregateFilter) flush(end time.Time) {
+	deadline := time.Now().Add(a.window)
+	waiting := func() bool { return time.Now().Before(deadline) }
+	dropped := 0
+	for _, key := range a.order {
+		event := NewEvent(a.tag, a.summary(a.groups[key], end))
+		event.Timestamp = end
+		if !a.outputQueue.putWait(event, waiting) {
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		log.Printf("AggregateFilter: dropped %d summary events because the queue was full", dropped)
+	}
+	if a.overflow > 0 {
+		log.Printf("AggregateFilter: %d events were not aggregated because the window had more than %d groups", a.overflow, a.maxGroups)
+	}
+	a.groups = make(map[string]*aggregateGroup)
+	a.order = nil
+	a.overflow = 0
+}
+
+func (a *AggregateFilter) summary(group *aggregateGroup, end time.Time) map[string]interface{} {
+	record := map[string]interface{}{
+		"window_start": a.windowStart.Format(time.RFC3339Nano),
+		"window_end":   end.Format(time.RFC3339Nano),
+		"count":        group.count,
+	}
+	for _, key := range a.groupKeys {
+		if err := key.Set(record, group.values[key]); err != nil {
+			log.Printf("Error setting group key %s: %v", key, err)
+		}
+	}
+
+	stats := make(map[string]interface{}, len(a.fields))
+	for i, key := range a.fields {
+		f := group.fields[i]
+		fieldStats := map[string]interface{}{"count": f.count}
+		if f.count > 0 {
+			fieldStats["sum"] = f.sum
+			fieldStats["min"] = f.min
+			fieldStats["max"] = f.max
+			fieldStats["avg"] = f.sum / float64(f.count)
+		}
+		if len(a.percentiles) > 0 && len(f.samples) > 0 {
+			sort.Float64s(f.samples)
+			for _, p := range a.percentiles {
+				fieldStats["p"+strconv.FormatFloat(p, 'f', -1, 64)] = percentile(f.samples, p)
+			}
+		}
+		if len(a.buckets) > 0 {
+			// 与 Prometheus 直方图一样，桶的计数是累积的
+			buckets := make(map[string]interface{}, len(f.buckets))
+			var cumulative int64
+			for j, count := range f.buckets {
+				cumulative += count
+				le := "+Inf"
+				if j < len(a.buckets) {
+					le = strconv.FormatFloat(a.buckets[j], 'f', -1, 64)
+				}
+				buckets[le] = cumulative
+			}
+			fieldStats["buckets"] = buckets
+		}
+		if err := key.Set(stats, fieldStats); err != nil {
+			log.Printf("Error setting stats for %s: %v", key, err)
+		}
+	}
+	if len(stats) > 0 {
+		record["stats"] = stats
+	}
+	return record
+}
+
+// percentile 按最近秩法计算已排序样本的百分位数
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// Start 启动过滤插件
+func (a *AggregateFilter) Start() {
+	if a.IsRunning() {
+		return
+	}
+	a.stop = make(chan struct{})
+	a.startLoop("AggregateFilter", a.Filter)
+
+	interval := a.window
+	if interval > time.Second {
+		interval = time.Second
+	}
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-a.stop:
+				return
+			case now := <-ticker.C:
+				a.groupsMu.Lock()
+				a.rollWindow(now)
+				a.groupsMu.Unlock()
+			}
+		}
+	}()
+}
+
+// Stop 停止过滤插件，发出当前未结束窗口的汇总事件
+func (a *AggregateFilter) Stop() {
+	a.halt()
+	a.release()
+}
+
+// halt 停止处理循环和窗口定时器，之后 drain 进来的事件仍然计入当前窗口
+func (a *AggregateFilter) halt() {
+	if !a.IsRunning() {
+		return
+	}
+	close(a.stop)
+	a.stopLoop("AggregateFilter")
+}
+
+// release 发出当前未结束窗口的汇总事件
+func (a *AggregateFilter) release() {
+	a.groupsMu.Lock()
+	defer a.groupsMu.Unlock()
+	a.flush(time.Now())
+}
@@ -0,0 +1,121 @@
+package plugin
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAggregateSummary(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  []string
+		records []map[string]interface{}
+		count   int64
+		stats   map[string]int64
+	}{
+		{
+			name:    "field named count",
+			fields:  []string{"count"},
+			records: []map[string]interface{}{{"count": 5}, {"count": 7}, {}},
+			count:   3,
+			stats:   map[string]int64{"count": 2},
+		},
+		{
+			name:    "nested field",
+			fields:  []string{"$.req.latency", "window_end"},
+			records: []map[string]interface{}{{"req": map[string]interface{}{"latency": 1.5}, "window_end": 3}},
+			count:   1,
+			stats:   map[string]int64{"req.latency": 1, "window_end": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := NewQueue(10)
+			a, err := NewAggregateFilter(NewQueue(10), out, "**", AggregateOptions{Fields: tt.fields, Window: time.Hour})
+			if err != nil {
+				t.Fatalf("NewAggregateFilter: %v", err)
+			}
+			for _, record := range tt.records {
+				a.Filter(NewEvent("app", record))
+			}
+			a.flush(time.Now())
+
+			event, ok := out.Get()
+			if !ok {
+				t.Fatal("no summary event")
+			}
+			if event.Record["count"] != tt.count {
+				t.Errorf("count = %v, want %d", event.Record["count"], tt.count)
+			}
+			stats, _ := event.Record["stats"].(map[string]interface{})
+			for path, want := range tt.stats {
+				accessor, _ := NewRecordAccessor("$." + path)
+				value, _ := accessor.Get(stats)
+				fieldStats, _ := value.(map[string]interface{})
+				if fieldStats["count"] != want {
+					t.Errorf("stats %s = %v, want count %d", path, value, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAggregateGroupKeyConflict(t *testing.T) {
+	for _, key := range []string{"count", "stats", "$.window_start.x"} {
+		if _, err := NewAggregateFilter(NewQueue(1), NewQueue(1), "**", AggregateOptions{GroupKeys: []string{key}}); err == nil {
+			t.Errorf("group key %s: want error", key)
+		}
+	}
+}
+
+func TestAggregateFlushWaitsForQueue(t *testing.T) {
+	const groups = 50
+	out := NewQueue(5)
+	a, err := NewAggregateFilter(NewQueue(1), out, "**", AggregateOptions{GroupKeys: []string{"id"}, Window: time.Hour})
+	if err != nil {
+		t.Fatalf("NewAggregateFilter: %v", err)
+	}
+	for i := 0; i < groups; i++ {
+		a.Filter(NewEvent("app", map[string]interface{}{"id": fmt.Sprint(i)}))
+	}
+
+	received := make(chan int)
+	go func() {
+		n := 0
+		deadline := time.Now().Add(5 * time.Second)
+		for n < groups && time.Now().Before(deadline) {
+			if _, ok := out.Get(); ok {
+				n++
+			} else {
+				time.Sleep(time.Millisecond)
+			}
+		}
+		received <- n
+	}()
+	a.flush(time.Now())
+
+	if n := <-received; n != groups {
+		t.Errorf("received %d summary events, want %d", n, groups)
+	}
+	if n := out.Dropped(); n != 0 {
+		t.Errorf("dropped %d summary events", n)
+	}
+}
+
+func TestAggregateStopWithRewrittenEvents(t *testing.T) {
+	events := runStopPipeline(t, func(in, out *Queue) FilterPlugin {
+		a, err := NewAggregateFilter(in, out, "rewritten", AggregateOptions{Tag: "rewritten", Window: time.Hour})
+		if err != nil {
+			t.Fatalf("NewAggregateFilter: %v", err)
+		}
+		a.Start()
+		return a
+	}, map[string]interface{}{"level": "ERROR"}, 100)
+	if len(events) != 1 {
+		t.Fatalf("routed %d events, want one summary", len(events))
+	}
+	if count := events[0].Record["count"]; count != int64(100) {
+		t.Errorf("count = %v, want 100", count)
+	}
+}
@@ -0,0 +1,313 @@
+package plugin
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultConcatFlushInterval 默认的等待超时时间，超时后发出已拼接的部分
+	DefaultConcatFlushInterval = 60 * time.Second
+	// DefaultConcatMaxSize 默认的拼接结果最大字节数
+	DefaultConcatMaxSize = 512 * 1024
+)
+
+// ConcatOptions concat 过滤插件的配置。拼接方式二选一：
+// 按 StartRegex/ContinueRegex/EndRegex 判断一行是新记录的开头、延续还是结尾；
+// 或按 PartialKey 判断记录是否只是一部分 (例如 Docker 把超过 16KB 的日志拆分后带的 partial_message)
+type ConcatOptions struct {
+	// Key 要拼接的字段，默认为 message
+	Key string
+	// Separator 拼接时的分隔符，正则方式默认为换行，PartialKey 方式默认为空
+	Separator string
+	// StreamKeys 与标签一起区分不同的流，只有同一个流的记录会被拼接
+	StreamKeys []string
+
+	StartRegex    string
+	ContinueRegex string
+	EndRegex      string
+
+	// PartialKey 的值等于 PartialValue (默认为 true) 时表示后面还有内容
+	PartialKey     string
+	PartialValue   string
+	KeepPartialKey bool
+
+	// FlushInterval 一个流超过这个时间没有新记录时发出已拼接的部分
+	FlushInterval time.Duration
+	// MaxSize 拼接结果超过这个字节数时立即发出
+	MaxSize int
+}
+
+// ConcatFilter 将拆分成多条的记录拼接为一条，拼接结果使用第一条记录的其他字段和时间
+type ConcatFilter struct {
+	*BaseFilter
+	key           *RecordAccessor
+	separator     string
+	streamKeys    []*RecordAccessor
+	start         *regexp.Regexp
+	continues     *regexp.Regexp
+	end           *regexp.Regexp
+	partialKey    *RecordAccessor
+	partialValue  string
+	keepPartial   bool
+	flushInterval time.Duration
+	maxSize       int
+
+	buffersMu sync.Mutex
+	buffers   map[string]*concatBuffer
+	stop      chan struct{}
+}
+
+type concatBuffer struct {
+	event   *Event
+	parts   []string
+	size    int
+	updated time.Time
+}
+
+// NewConcatFilter 创建一个新的拼接过滤插件
+func NewConcatFilter(inputQueue, outputQueue *Queue, matchTag string, opts ConcatOptions) (*ConcatFilter, error) {
+	if opts.Key == "" {
+		opts.Key = "message"
+	}
+	key, err := NewRecordAccessor(opts.Key)
+	if err != nil {
+		return nil, err
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultConcatFlushInterval
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultConcatMaxSize
+	}
+
+	c := &ConcatFilter{
+		BaseFilter:    NewBaseFilter(inputQueue, outputQueue, matchTag),
+		key:           key,
+		separator:     opts.Separator,
+		keepPartial:   opts.KeepPartialKey,
+		flushInterval: opts.FlushInterval,
+		maxSize:       opts.MaxSize,
+		buffers:       make(map[string]*concatBuffer),
+	}
+	for _, k := range opts.StreamKeys {
+		accessor, err := NewRecordAccessor(k)
+		if err != nil {
+			return nil, err
+		}
+		c.streamKeys = append(c.streamKeys, accessor)
+	}
+
+	compile := func(name, expr string) (*regexp.Regexp, error) {
+		if expr == "" {
+			return nil, nil
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", name, err)
+		}
+		return re, nil
+	}
+	if c.start, err = compile("start_regex", opts.StartRegex); err != nil {
+		return nil, err
+	}
+	if c.continues, err = compile("continue_regex", opts.ContinueRegex); err != nil {
+		return nil, err
+	}
+	if c.end, err = compile("end_regex", opts.EndRegex); err != nil {
+		return nil, err
+	}
+
+	regexMode := c.start != nil || c.continues != nil || c.end != nil
+	switch {
+	case opts.PartialKey != "" && regexMode:
+		return nil, fmt.Errorf("concat filter accepts either partial_key or regex rules, not both")
+	case opts.PartialKey != "":
+		if c.partialKey, err = NewRecordAccessor(opts.PartialKey); err != nil {
+			return nil, err
+		}
+		c.partialValue = opts.PartialValue
+		if c.partialValue == "" {
+			c.partialValue = "true"
+		}
+	case regexMode:
+		if c.separator == "" {
+			c.separator = "\n"
+		}
+	default:
+		return nil, fmt.Errorf("concat filter requires start_regex, continue_regex, end_regex or partial_key")
+	}
+	return c, nil
+}
+
+func (c *ConcatFilter) streamOf(event *Event) string {
+	parts := make([]string, 0, len(c.streamKeys)+1)
+	parts = append(parts, event.Tag)
+	for _, key := range c.streamKeys {
+		value, _ := key.Get(event.Record)
+		parts = append(parts, toString(value))
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// Filter 执行过滤操作，被缓存的记录返回 nil，拼接完成的记录直接放入输出队列
+func (c *ConcatFilter) Filter(event *Event) *Event {
+	value, ok := c.key.Get(event.Record)
+	line, isString := value.(string)
+	if !ok || !isString {
+		return event
+	}
+	stream := c.streamOf(event)
+
+	c.buffersMu.Lock()
+	defer c.buffersMu.Unlock()
+
+	if c.partialKey != nil {
+		partial, _ := c.partialKey.Get(event.Record)
+		if !c.keepPartial {
+			c.partialKey.Delete(event.Record)
+		}
+		c.append(stream, event, line)
+		if toString(partial) != c.partialValue {
+			c.flush(stream)
+		}
+		return nil
+	}
+
+	buffer := c.buffers[stream]
+	switch {
+	case c.start != nil && c.start.MatchString(line):
+		// 新记录的开头，之前的部分先发出
+		c.flush(stream)
+		c.append(stream, event, line)
+	case c.continues != nil:
+		if !c.continues.MatchString(line) {
+			c.flush(stream)
+			if c.start != nil {
+				return event
+			}
+			c.append(stream, event, line)
+		} else if buffer != nil {
+			c.append(stream, event, line)
+		} else {
+			return event
+		}
+	case buffer != nil:
+		c.append(stream, event, line)
+	case c.start != nil:
+		// 没有开头的孤立行原样通过
+		return event
+	default:
+		// 只有 end_regex 时每一行都开始或延续一条记录
+		c.append(stream, event, line)
+	}
+
+	if c.end != nil && c.end.MatchString(line) {
+		c.flush(stream)
+	}
+	return nil
+}
+
+// append 把一行加入流的缓存，超过 MaxSize 时立即发出
+func (c *ConcatFilter) append(stream string, event *Event, line string) {
+	buffer := c.buffers[stream]
+	if buffer == nil {
+		buffer = &concatBuffer{event: event}
+		c.buffers[stream] = buffer
+	} else {
+		buffer.size += len(c.separator)
+	}
+	buffer.parts = append(buffer.parts, line)
+	buffer.size += len(line)
+	buffer.updated = time.Now()
+	if buffer.size >= c.maxSize {
+		c.flush(stream)
+	}
+}
+
+// flush 发出流中已拼接的部分
+func (c *ConcatFilter) flush(stream string) {
+	buffer := c.buffers[stream]
+	if buffer == nil {
+		return
+	}
+	delete(c.buffers, stream)
+	c.key.Set(buffer.event.Record, strings.Join(buffer.parts, c.separator))
+	c.put(buffer.event)
+}
+
+// flushExpired 发出超时的流，all 为 true 时发出所有流
+func (c *ConcatFilter) flushExpired(all bool) {
+	now := time.Now()
+
+	c.buffersMu.Lock()
+	defer c.buffersMu.Unlock()
+
+	var streams []string
+	for stream, buffer := range c.buffers {
+		if all || now.Sub(buffer.updated) >= c.flushInterval {
+			streams = append(streams, stream)
+		}
+	}
+	// 按第一条记录的时间发出，尽量保持顺序
+	sort.Slice(streams, func(i, j int) bool {
+		return c.buffers[streams[i]].event.Timestamp.Before(c.buffers[streams[j]].event.Timestamp)
+	})
+	for _, stream := range streams {
+		c.flush(stream)
+	}
+}
+
+// Start 启动过滤插件
+func (c *ConcatFilter) Start() {
+	if c.IsRunning() {
+		return
+	}
+	c.stop = make(chan struct{})
+	c.startLoop("ConcatFilter", c.Filter)
+
+	interval := c.flushInterval / 2
+	if interval > time.Second {
+		interval = time.Second
+	} else if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+				c.flushExpired(false)
+			}
+		}
+	}()
+}
+
+// Stop 停止过滤插件，未完成的拼接立即发出
+func (c *ConcatFilter) Stop() {
+	c.halt()
+	c.release()
+}
+
+// halt 停止处理循环和超时检查，之后 drain 进来的记录仍然会拼接
+func (c *ConcatFilter) halt() {
+	if !c.IsRunning() {
+		return
+	}
+	close(c.stop)
+	c.stopLoop("ConcatFilter")
+}
+
+// release 发出所有未完成的拼接
+func (c *ConcatFilter) release() {
+	c.flushExpired(true)
+}
@@ -0,0 +1,237 @@
+package plugin
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// concatInput concat 测试的一条输入，tag 为空时使用 app
+type concatInput struct {
+	tag    string
+	record map[string]interface{}
+}
+
+func messages(lines ...string) []concatInput {
+	inputs := make([]concatInput, len(lines))
+	for i, line := range lines {
+		inputs[i] = concatInput{record: map[string]interface{}{"message": line}}
+	}
+	return inputs
+}
+
+func TestConcatFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   ConcatOptions
+		inputs []concatInput
+		want   []map[string]interface{}
+	}{
+		{
+			name:   "start regex",
+			opts:   ConcatOptions{StartRegex: `^\d{4}-`},
+			inputs: messages("  orphan", "2024-01-01 a", "  at x", "  at y", "2024-01-01 b"),
+			want: []map[string]interface{}{
+				{"message": "  orphan"},
+				{"message": "2024-01-01 a\n  at x\n  at y"},
+				{"message": "2024-01-01 b"},
+			},
+		},
+		{
+			name:   "continue regex",
+			opts:   ConcatOptions{ContinueRegex: `^\s`},
+			inputs: messages("a", " b", " c", "d"),
+			want:   []map[string]interface{}{{"message": "a\n b\n c"}, {"message": "d"}},
+		},
+		{
+			name:   "start and continue regex",
+			opts:   ConcatOptions{StartRegex: `^S`, ContinueRegex: `^\s`},
+			inputs: messages("S1", " x", "y", "S2"),
+			want:   []map[string]interface{}{{"message": "S1\n x"}, {"message": "y"}, {"message": "S2"}},
+		},
+		{
+			name:   "end regex",
+			opts:   ConcatOptions{EndRegex: `;$`, Separator: " "},
+			inputs: messages("a", "b;", "c;"),
+			want:   []map[string]interface{}{{"message": "a b;"}, {"message": "c;"}},
+		},
+		{
+			name: "partial key",
+			opts: ConcatOptions{PartialKey: "partial"},
+			inputs: []concatInput{
+				{record: map[string]interface{}{"message": "ab", "partial": "true", "seq": 1}},
+				{record: map[string]interface{}{"message": "cd", "partial": "true", "seq": 2}},
+				{record: map[string]interface{}{"message": "e", "partial": "false", "seq": 3}},
+			},
+			want: []map[string]interface{}{{"message": "abcde", "seq": 1}},
+		},
+		{
+			name: "keep partial key",
+			opts: ConcatOptions{PartialKey: "partial", PartialValue: "yes", KeepPartialKey: true},
+			inputs: []concatInput{
+				{record: map[string]interface{}{"message": "ab", "partial": "yes"}},
+				{record: map[string]interface{}{"message": "c"}},
+			},
+			want: []map[string]interface{}{{"message": "abc", "partial": "yes"}},
+		},
+		{
+			name: "stream keys",
+			opts: ConcatOptions{PartialKey: "partial", StreamKeys: []string{"stream"}},
+			inputs: []concatInput{
+				{record: map[string]interface{}{"message": "o1", "partial": "true", "stream": "stdout"}},
+				{record: map[string]interface{}{"message": "e1", "partial": "true", "stream": "stderr"}},
+				{record: map[string]interface{}{"message": "o2", "stream": "stdout"}},
+				{record: map[string]interface{}{"message": "e2", "stream": "stderr"}},
+			},
+			want: []map[string]interface{}{
+				{"message": "o1o2", "stream": "stdout"},
+				{"message": "e1e2", "stream": "stderr"},
+			},
+		},
+		{
+			name: "tags are separate streams",
+			opts: ConcatOptions{PartialKey: "partial"},
+			inputs: []concatInput{
+				{tag: "a", record: map[string]interface{}{"message": "a1", "partial": "true"}},
+				{tag: "b", record: map[string]interface{}{"message": "b1", "partial": "true"}},
+				{tag: "a", record: map[string]interface{}{"message": "a2"}},
+				{tag: "b", record: map[string]interface{}{"message": "b2"}},
+			},
+			want: []map[string]interface{}{{"message": "a1a2"}, {"message": "b1b2"}},
+		},
+		{
+			name: "max size",
+			opts: ConcatOptions{PartialKey: "partial", MaxSize: 5},
+			inputs: []concatInput{
+				{record: map[string]interface{}{"message": "abc", "partial": "true"}},
+				{record: map[string]interface{}{"message": "def", "partial": "true"}},
+				{record: map[string]interface{}{"message": "g"}},
+			},
+			want: []map[string]interface{}{{"message": "abcdef"}, {"message": "g"}},
+		},
+		{
+			name:   "unfinished record flushed at the end",
+			opts:   ConcatOptions{StartRegex: `^S`},
+			inputs: messages("S1", "x"),
+			want:   []map[string]interface{}{{"message": "S1\nx"}},
+		},
+		{
+			name: "non-string key passes through",
+			opts: ConcatOptions{Key: "$.log.text", PartialKey: "partial"},
+			inputs: []concatInput{
+				{record: map[string]interface{}{"log": map[string]interface{}{"text": 42}}},
+				{record: map[string]interface{}{"message": "no key"}},
+			},
+			want: []map[string]interface{}{
+				{"log": map[string]interface{}{"text": 42}},
+				{"message": "no key"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := NewQueue(100)
+			c, err := NewConcatFilter(NewQueue(1), out, "**", tt.opts)
+			if err != nil {
+				t.Fatalf("NewConcatFilter: %v", err)
+			}
+			var got []map[string]interface{}
+			collect := func() {
+				for {
+					event, ok := out.Get()
+					if !ok {
+						return
+					}
+					got = append(got, event.Record)
+				}
+			}
+			for _, input := range tt.inputs {
+				tag := input.tag
+				if tag == "" {
+					tag = "app"
+				}
+				// Filter 中发出的记录在返回的记录之前进入输出队列
+				event := c.Filter(NewEvent(tag, input.record))
+				collect()
+				if event != nil {
+					got = append(got, event.Record)
+				}
+			}
+			c.flushExpired(true)
+			collect()
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("records = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewConcatFilterErrors(t *testing.T) {
+	for _, opts := range []ConcatOptions{
+		{},
+		{PartialKey: "partial", StartRegex: "^S"},
+		{StartRegex: "("},
+		{ContinueRegex: "("},
+		{EndRegex: "("},
+		{Key: "$.", StartRegex: "^S"},
+	} {
+		if _, err := NewConcatFilter(NewQueue(1), NewQueue(1), "**", opts); err == nil {
+			t.Errorf("NewConcatFilter(%+v): want error", opts)
+		}
+	}
+}
+
+func TestConcatFlushExpired(t *testing.T) {
+	out := NewQueue(10)
+	c, err := NewConcatFilter(NewQueue(1), out, "**", ConcatOptions{PartialKey: "partial", FlushInterval: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewConcatFilter: %v", err)
+	}
+	c.Filter(NewEvent("app", map[string]interface{}{"message": "a", "partial": "true"}))
+
+	c.flushExpired(false)
+	if n := out.Len(); n != 0 {
+		t.Fatalf("flushed %d records before the interval", n)
+	}
+	time.Sleep(80 * time.Millisecond)
+	c.flushExpired(false)
+	if event, ok := out.Get(); !ok || event.Record["message"] != "a" {
+		t.Errorf("flushed %v, want the expired record", event)
+	}
+}
+
+func TestConcatFilterShortFlushInterval(t *testing.T) {
+	out := NewQueue(10)
+	c, err := NewConcatFilter(NewQueue(10), out, "**", ConcatOptions{PartialKey: "partial", FlushInterval: time.Nanosecond})
+	if err != nil {
+		t.Fatalf("NewConcatFilter: %v", err)
+	}
+	c.Start()
+	c.Filter(NewEvent("app", map[string]interface{}{"message": "a", "partial": "true"}))
+	time.Sleep(20 * time.Millisecond)
+	c.Stop()
+
+	event, ok := out.Get()
+	if !ok || event.Record["message"] != "a" {
+		t.Errorf("flushed %v, want the partial record", event)
+	}
+}
+
+func TestConcatFilterStopWithRewrittenEvents(t *testing.T) {
+	events := runStopPipeline(t, func(in, out *Queue) FilterPlugin {
+		c, err := NewConcatFilter(in, out, "rewritten", ConcatOptions{PartialKey: "partial"})
+		if err != nil {
+			t.Fatalf("NewConcatFilter: %v", err)
+		}
+		c.Start()
+		return c
+	}, map[string]interface{}{"level": "ERROR", "message": "x", "partial": "true"}, 100)
+	if len(events) != 1 {
+		t.Fatalf("routed %d events, want one concatenated record", len(events))
+	}
+	if message := events[0].Record["message"]; message != strings.Repeat("x", 100) {
+		t.Errorf("message = %v, want 100 parts", message)
+	}
+}
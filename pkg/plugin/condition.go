@@ -0,0 +1,330 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConditionSpec 条件树的配置：Fields 中每个字段的条件都要满足，
+// And 中的每个子条件都要满足，Or 中至少一个子条件满足
+//
+// 字段条件的格式为 "<操作符><目标>"，支持的操作符：
+//
+//	=value  !=value          相等/不等，两边都是数字时按数值比较，省略操作符时为 =
+//	>1.0 >=1 <5 <=5          数值比较，字段可以是 int、float 或数字字符串
+//	~regex  !~regex          正则匹配/不匹配
+//	in a,b,"c,d"             在列表中
+//	not in a,b               不在列表中
+//	exists  !exists          字段存在/不存在
+//
+// 字段名支持 record accessor 语法，字段不存在时，除 !exists 外的条件都不满足。
+// 以 "in " 或 "not in " 开头的字符串会被当作列表条件，要比较这样的字符串时写成 "=in progress"。
+// 空的条件（没有任何字段、and 和 or）是配置错误，避免 exclude: {} 丢弃所有事件
+type ConditionSpec struct {
+	Fields map[string]string
+	And    []ConditionSpec
+	Or     []ConditionSpec
+}
+
+// Condition 编译后的条件树
+type Condition struct {
+	fields []*fieldCondition
+	and    []*Condition
+	or     []*Condition
+}
+
+type fieldCondition struct {
+	key      *RecordAccessor
+	operator string
+	target   string
+	number   float64
+	isNumber bool
+	regex    *regexp.Regexp
+	list     []string
+}
+
+// NewCondition 编译条件树，条件为空、操作符或正则表达式无效时返回错误
+func NewCondition(spec ConditionSpec) (*Condition, error) {
+	if len(spec.Fields) == 0 && len(spec.And) == 0 && len(spec.Or) == 0 {
+		return nil, fmt.Errorf("empty condition")
+	}
+	c := &Condition{}
+
+	// 按字段名排序，保证求值顺序稳定
+	keys := make([]string, 0, len(spec.Fields))
+	for key := range spec.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		field, err := newFieldCondition(key, spec.Fields[key])
+		if err != nil {
+			return nil, err
+		}
+		c.fields = append(c.fields, field)
+	}
+
+	for _, sub := range spec.And {
+		cond, err := NewCondition(sub)
+		if err != nil {
+			return nil, err
+		}
+		c.and = append(c.and, cond)
+	}
+	for _, sub := range spec.Or {
+		cond, err := NewCondition(sub)
+		if err != nil {
+			return nil, err
+		}
+		c.or = append(c.or, cond)
+	}
+	return c, nil
+}
+
+// Evaluate 检查记录是否满足条件
+func (c *Condition) Evaluate(record map[string]interface{}) bool {
+	for _, field := range c.fields {
+		if !field.evaluate(record) {
+			return false
+		}
+	}
+	for _, cond := range c.and {
+		if !cond.Evaluate(record) {
+			return false
+		}
+	}
+	if len(c.or) > 0 {
+		for _, cond := range c.or {
+			if cond.Evaluate(record) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func newFieldCondition(key, pattern string) (*fieldCondition, error) {
+	accessor, err := NewRecordAccessor(key)
+	if err != nil {
+		return nil, err
+	}
+	operator, target := parseOperator(pattern)
+	f := &fieldCondition{key: accessor, operator: operator, target: target}
+
+	switch operator {
+	case "~", "!~":
+		regex, err := regexp.Compile(target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex for %s: %v", key, err)
+		}
+		f.regex = regex
+	case ">", ">=", "<", "<=":
+		number, err := strconv.ParseFloat(strings.TrimSpace(target), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number for %s: %q", key, target)
+		}
+		f.number, f.isNumber = number, true
+	case "=", "!=":
+		if number, err := strconv.ParseFloat(strings.TrimSpace(target), 64); err == nil {
+			f.number, f.isNumber = number, true
+		}
+	case "in", "not in":
+		f.list = splitTarget(target)
+	}
+	return f, nil
+}
+
+// parseOperator 拆分操作符和目标值，没有操作符时视为 =
+func parseOperator(pattern string) (string, string) {
+	trimmed := strings.TrimSpace(pattern)
+	switch trimmed {
+	case "exists", "!exists":
+		return trimmed, ""
+	}
+
+	for _, op := range []string{"not in ", "in "} {
+		if strings.HasPrefix(trimmed, op) {
+			return strings.TrimSpace(op), strings.TrimSpace(trimmed[len(op):])
+		}
+	}
+
+	for _, op := range []string{">=", "<=", "!~", "!=", "~", ">", "<", "="} {
+		if strings.HasPrefix(pattern, op) {
+			return op, pattern[len(op):]
+		}
+	}
+	return "=", pattern
+}
+
+func (f *fieldCondition) evaluate(record map[string]interface{}) bool {
+	value, exists := f.key.Get(record)
+
+	switch f.operator {
+	case "exists":
+		return exists
+	case "!exists":
+		return !exists
+	}
+	if !exists {
+		return false
+	}
+
+	switch f.operator {
+	case "=", "!=":
+		equal := false
+		if number, ok := toNumber(value); ok && f.isNumber {
+			equal = number == f.number
+		} else {
+			equal = toString(value) == f.target
+		}
+		return equal == (f.operator == "=")
+	case ">", ">=", "<", "<=":
+		number, ok := toNumber(value)
+		if !ok {
+			return false
+		}
+		switch f.operator {
+		case ">":
+			return number > f.number
+		case ">=":
+			return number >= f.number
+		case "<":
+			return number < f.number
+		default:
+			return number <= f.number
+		}
+	case "~":
+		return f.regex.MatchString(toString(value))
+	case "!~":
+		return !f.regex.MatchString(toString(value))
+	case "in", "not in":
+		s := toString(value)
+		found := false
+		for _, item := range f.list {
+			if s == item {
+				found = true
+				break
+			}
+		}
+		return found == (f.operator == "in")
+	}
+	return false
+}
+
+// toNumber 将 int、float 和数字字符串转换为 float64
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// toString 将字段值转换为字符串，用于字符串比较和正则匹配
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+	return fmt.Sprint(value)
+}
+
+// splitTarget 按逗号拆分列表，引号内的逗号不拆分
+func splitTarget(target string) []string {
+	var result []string
+	start := 0
+	inQuotes := false
+
+	for i, c := range target {
+		if c == '"' {
+			inQuotes = !inQuotes
+		} else if c == ',' && !inQuotes {
+			if i > start {
+				result = append(result, trimQuotes(strings.TrimSpace(target[start:i])))
+			}
+			start = i + 1
+		}
+	}
+
+	if start < len(target) {
+		result = append(result, trimQuotes(strings.TrimSpace(target[start:])))
+	}
+
+	return result
+}
+
+// 去除引号
+func trimQuotes(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// ConditionFilter 按字段条件过滤事件：满足 match 且不满足 exclude 的事件被保留
+type ConditionFilter struct {
+	*BaseFilter
+	match   *Condition
+	exclude *Condition
+}
+
+// NewConditionFilter 创建一个新的字段条件过滤插件，match 或 exclude 为 nil 时不检查
+func NewConditionFilter(inputQueue, outputQueue *Queue, matchTag string, match, exclude *Condition) *ConditionFilter {
+	return &ConditionFilter{
+		BaseFilter: NewBaseFilter(inputQueue, outputQueue, matchTag),
+		match:      match,
+		exclude:    exclude,
+	}
+}
+
+// Filter 执行过滤操作
+func (c *ConditionFilter) Filter(event *Event) *Event {
+	if c.match != nil && !c.match.Evaluate(event.Record) {
+		return nil
+	}
+	if c.exclude != nil && c.exclude.Evaluate(event.Record) {
+		return nil
+	}
+	return event
+}
+
+// Start 启动过滤插件
+func (c *ConditionFilter) Start() {
+	c.startLoop("ConditionFilter", c.Filter)
+}
+
+// Stop 停止过滤插件
+func (c *ConditionFilter) Stop() {
+	c.stopLoop("ConditionFilter")
+}
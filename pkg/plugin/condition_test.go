@@ -0,0 +1,212 @@
+package plugin
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseOperator(t *testing.T) {
+	tests := []struct {
+		pattern, op, target string
+	}{
+		{"exists", "exists", ""},
+		{"!exists", "!exists", ""},
+		{" exists ", "exists", ""},
+		{"in a,b", "in", "a,b"},
+		{"not in a, b ", "not in", "a, b"},
+		{">=10", ">=", "10"},
+		{"<=10", "<=", "10"},
+		{">10", ">", "10"},
+		{"<10", "<", "10"},
+		{"!=ok", "!=", "ok"},
+		{"=ok", "=", "ok"},
+		{"~^a.*", "~", "^a.*"},
+		{"!~^a.*", "!~", "^a.*"},
+		{"ok", "=", "ok"},
+		{"", "=", ""},
+		// 以 in / not in 开头的字符串需要显式写 =
+		{"=in progress", "=", "in progress"},
+		{"=not in stock", "=", "not in stock"},
+		{"inside", "=", "inside"},
+		{"in progress", "in", "progress"},
+	}
+	for _, tt := range tests {
+		op, target := parseOperator(tt.pattern)
+		if op != tt.op || target != tt.target {
+			t.Errorf("parseOperator(%q) = (%q, %q), want (%q, %q)", tt.pattern, op, target, tt.op, tt.target)
+		}
+	}
+}
+
+func TestNewFieldCondition(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		pattern  string
+		wantErr  bool
+		isNumber bool
+		number   float64
+		list     []string
+	}{
+		{name: "invalid regex", key: "msg", pattern: "~(", wantErr: true},
+		{name: "invalid number", key: "status", pattern: ">abc", wantErr: true},
+		{name: "invalid key", key: "$.", pattern: "=1", wantErr: true},
+		{name: "numeric equality", key: "latency", pattern: "=1.5", isNumber: true, number: 1.5},
+		{name: "numeric comparison", key: "status", pattern: ">= 500", isNumber: true, number: 500},
+		{name: "string equality", key: "level", pattern: "=abc"},
+		{name: "list", key: "level", pattern: "in a, b ,c", list: []string{"a", "b", "c"}},
+		{name: "quoted list", key: "level", pattern: `in "a,b",c`, list: []string{"a,b", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newFieldCondition(tt.key, tt.pattern)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("newFieldCondition(%q, %q) succeeded, want error", tt.key, tt.pattern)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newFieldCondition(%q, %q): %v", tt.key, tt.pattern, err)
+			}
+			if f.isNumber != tt.isNumber || f.number != tt.number {
+				t.Errorf("number = (%v, %v), want (%v, %v)", f.number, f.isNumber, tt.number, tt.isNumber)
+			}
+			if !reflect.DeepEqual(f.list, tt.list) {
+				t.Errorf("list = %q, want %q", f.list, tt.list)
+			}
+		})
+	}
+}
+
+func TestConditionEvaluate(t *testing.T) {
+	record := map[string]interface{}{
+		"status":  int64(500),
+		"latency": "1.5",
+		"level":   "ERROR",
+		"msg":     "in progress",
+		"user":    map[string]interface{}{"id": "42"},
+	}
+
+	tests := []struct {
+		name string
+		spec ConditionSpec
+		want bool
+	}{
+		{"number equal", ConditionSpec{Fields: map[string]string{"status": "500"}}, true},
+		{"number equal float", ConditionSpec{Fields: map[string]string{"status": "=500.0"}}, true},
+		{"number not equal", ConditionSpec{Fields: map[string]string{"status": "!=404"}}, true},
+		{"number greater", ConditionSpec{Fields: map[string]string{"status": ">=500"}}, true},
+		{"number less", ConditionSpec{Fields: map[string]string{"status": "<500"}}, false},
+		{"string number greater", ConditionSpec{Fields: map[string]string{"latency": ">1"}}, true},
+		{"string number equal", ConditionSpec{Fields: map[string]string{"latency": "=1.50"}}, true},
+		{"non-number comparison", ConditionSpec{Fields: map[string]string{"level": ">1"}}, false},
+		{"string equal", ConditionSpec{Fields: map[string]string{"level": "ERROR"}}, true},
+		{"string not equal", ConditionSpec{Fields: map[string]string{"level": "!=ERROR"}}, false},
+		{"in", ConditionSpec{Fields: map[string]string{"level": "in WARN, ERROR"}}, true},
+		{"in number", ConditionSpec{Fields: map[string]string{"status": "in 500,502"}}, true},
+		{"not in", ConditionSpec{Fields: map[string]string{"level": "not in WARN,ERROR"}}, false},
+		{"regex", ConditionSpec{Fields: map[string]string{"level": "~^ERR"}}, true},
+		{"negated regex", ConditionSpec{Fields: map[string]string{"level": "!~^ERR"}}, false},
+		{"regex number", ConditionSpec{Fields: map[string]string{"status": "~^5\\d\\d$"}}, true},
+		{"nested exists", ConditionSpec{Fields: map[string]string{"$.user.id": "exists"}}, true},
+		{"nested value", ConditionSpec{Fields: map[string]string{"$.user.id": "42"}}, true},
+		{"missing exists", ConditionSpec{Fields: map[string]string{"$.user.name": "exists"}}, false},
+		{"missing not exists", ConditionSpec{Fields: map[string]string{"host": "!exists"}}, true},
+		{"missing not equal", ConditionSpec{Fields: map[string]string{"host": "!=a"}}, false},
+		{"missing not in", ConditionSpec{Fields: map[string]string{"host": "not in a"}}, false},
+		{"literal in prefix", ConditionSpec{Fields: map[string]string{"msg": "=in progress"}}, true},
+		{"in prefix is a list", ConditionSpec{Fields: map[string]string{"msg": "in progress"}}, false},
+		{"all fields must match", ConditionSpec{Fields: map[string]string{"level": "ERROR", "status": "<500"}}, false},
+		{
+			name: "and",
+			spec: ConditionSpec{And: []ConditionSpec{
+				{Fields: map[string]string{"level": "ERROR"}},
+				{Fields: map[string]string{"status": ">=500"}},
+			}},
+			want: true,
+		},
+		{
+			name: "and with one false",
+			spec: ConditionSpec{And: []ConditionSpec{
+				{Fields: map[string]string{"level": "ERROR"}},
+				{Fields: map[string]string{"status": "<500"}},
+			}},
+			want: false,
+		},
+		{
+			name: "or",
+			spec: ConditionSpec{Or: []ConditionSpec{
+				{Fields: map[string]string{"level": "WARN"}},
+				{Fields: map[string]string{"status": "500"}},
+			}},
+			want: true,
+		},
+		{
+			name: "or all false",
+			spec: ConditionSpec{Or: []ConditionSpec{
+				{Fields: map[string]string{"level": "WARN"}},
+				{Fields: map[string]string{"status": "404"}},
+			}},
+			want: false,
+		},
+		{
+			name: "fields and or",
+			spec: ConditionSpec{
+				Fields: map[string]string{"level": "WARN"},
+				Or:     []ConditionSpec{{Fields: map[string]string{"status": "500"}}},
+			},
+			want: false,
+		},
+		{
+			name: "or of and",
+			spec: ConditionSpec{Or: []ConditionSpec{
+				{And: []ConditionSpec{
+					{Fields: map[string]string{"level": "ERROR"}},
+					{Fields: map[string]string{"$.user.id": "7"}},
+				}},
+				{And: []ConditionSpec{
+					{Fields: map[string]string{"level": "ERROR"}},
+					{Or: []ConditionSpec{
+						{Fields: map[string]string{"$.user.id": "42"}},
+						{Fields: map[string]string{"host": "exists"}},
+					}},
+				}},
+			}},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cond, err := NewCondition(tt.spec)
+			if err != nil {
+				t.Fatalf("NewCondition: %v", err)
+			}
+			if got := cond.Evaluate(record); got != tt.want {
+				t.Errorf("Evaluate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewConditionEmpty(t *testing.T) {
+	tests := []struct {
+		name string
+		spec ConditionSpec
+	}{
+		{"top level", ConditionSpec{}},
+		{"empty fields", ConditionSpec{Fields: map[string]string{}}},
+		{"nested and", ConditionSpec{And: []ConditionSpec{{}}}},
+		{"nested or", ConditionSpec{
+			Fields: map[string]string{"level": "ERROR"},
+			Or:     []ConditionSpec{{Fields: map[string]string{"status": "500"}}, {}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewCondition(tt.spec); err == nil {
+				t.Error("NewCondition succeeded, want error for empty condition")
+			}
+		})
+	}
+}
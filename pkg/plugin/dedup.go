@@ -0,0 +1,207 @@
+package plugin
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// DefaultDedupMaxEntries 默认最多记录的哈希数
+const DefaultDedupMaxEntries = 100000
+
+// DedupOptions dedup 过滤插件的配置
+type DedupOptions struct {
+	// Keys 参与去重的字段，支持 record accessor 语法，为空时使用整条记录
+	Keys []string
+	// Window 去重时间窗口，从第一次出现开始计算，默认 60 秒
+	Window time.Duration
+	// MaxEntries 最多记录的哈希数，超过时淘汰最久没有出现的记录
+	MaxEntries int
+	// RepeatCountKey 不为空时第一条事件会保留到时间窗口结束，
+	// 再带上这个字段 (窗口内出现的总次数) 发出
+	RepeatCountKey string
+}
+
+// DedupFilter 丢弃时间窗口内重复出现的事件
+type DedupFilter struct {
+	*BaseFilter
+	keys           []*RecordAccessor
+	window         time.Duration
+	repeatCountKey *RecordAccessor
+
+	entriesMu sync.Mutex
+	entries   *lruCache[[sha256.Size]byte, *dedupEntry]
+	// expiry 按过期时间排序的记录，时间窗口固定，所以就是第一次出现的顺序
+	expiry *list.List
+	stop   chan struct{}
+}
+
+type dedupEntry struct {
+	hash    [sha256.Size]byte
+	elem    *list.Element
+	expires time.Time
+	count   int64
+	// event 等待窗口结束后发出的事件，只在设置了 RepeatCountKey 时使用
+	event *Event
+}
+
+// NewDedupFilter 创建一个新的去重过滤插件
+func NewDedupFilter(inputQueue, outputQueue *Queue, matchTag string, opts DedupOptions) (*DedupFilter, error) {
+	if opts.Window <= 0 {
+		opts.Window = time.Minute
+	}
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = DefaultDedupMaxEntries
+	}
+
+	d := &DedupFilter{
+		BaseFilter: NewBaseFilter(inputQueue, outputQueue, matchTag),
+		window:     opts.Window,
+		entries:    newLRUCache[[sha256.Size]byte, *dedupEntry](opts.MaxEntries),
+		expiry:     list.New(),
+	}
+	for _, key := range opts.Keys {
+		accessor, err := NewRecordAccessor(key)
+		if err != nil {
+			return nil, err
+		}
+		d.keys = append(d.keys, accessor)
+	}
+	if opts.RepeatCountKey != "" {
+		accessor, err := NewRecordAccessor(opts.RepeatCountKey)
+		if err != nil {
+			return nil, err
+		}
+		d.repeatCountKey = accessor
+	}
+	return d, nil
+}
+
+// hash 计算参与去重的字段的哈希，map 按 key 排序序列化，保证结果稳定
+func (d *DedupFilter) hash(record map[string]interface{}) [sha256.Size]byte {
+	var value interface{} = record
+	if len(d.keys) > 0 {
+		values := make([]interface{}, len(d.keys))
+		for i, key := range d.keys {
+			values[i], _ = key.Get(record)
+		}
+		value = values
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		data = []byte(fmt.Sprintf("%#v", value))
+	}
+	return sha256.Sum256(data)
+}
+
+// Filter 执行过滤操作
+func (d *DedupFilter) Filter(event *Event) *Event {
+	hash := d.hash(event.Record)
+	now := time.Now()
+
+	d.entriesMu.Lock()
+	defer d.entriesMu.Unlock()
+
+	if entry, ok := d.entries.Get(hash); ok && now.Before(entry.expires) {
+		entry.count++
+		return nil
+	} else if ok {
+		d.emit(entry)
+		d.expiry.Remove(entry.elem)
+	}
+
+	entry := &dedupEntry{hash: hash, expires: now.Add(d.window), count: 1}
+	if d.repeatCountKey != nil {
+		entry.event = event
+		event = nil
+	}
+	entry.elem = d.expiry.PushBack(entry)
+	if _, evicted, ok := d.entries.Add(hash, entry); ok {
+		d.emit(evicted)
+		d.expiry.Remove(evicted.elem)
+	}
+	return event
+}
+
+// emit 发出等待窗口结束的事件
+func (d *DedupFilter) emit(entry *dedupEntry) {
+	if entry.event == nil {
+		return
+	}
+	if err := d.repeatCountKey.Set(entry.event.Record, entry.count); err != nil {
+		log.Printf("Error setting %s: %v", d.repeatCountKey, err)
+	}
+	d.put(entry.event)
+	entry.event = nil
+}
+
+// sweep 按第一次出现的先后顺序清理窗口已经结束的记录，遇到第一条没有过期的记录时停止，
+// all 为 true 时清理所有记录
+func (d *DedupFilter) sweep(all bool) {
+	now := time.Now()
+
+	d.entriesMu.Lock()
+	defer d.entriesMu.Unlock()
+
+	for elem := d.expiry.Front(); elem != nil; elem = d.expiry.Front() {
+		entry := elem.Value.(*dedupEntry)
+		if !all && now.Before(entry.expires) {
+			return
+		}
+		d.emit(entry)
+		d.expiry.Remove(elem)
+		d.entries.Remove(entry.hash)
+	}
+}
+
+// Start 启动过滤插件
+func (d *DedupFilter) Start() {
+	if d.IsRunning() {
+		return
+	}
+	d.stop = make(chan struct{})
+	d.startLoop("DedupFilter", d.Filter)
+
+	interval := d.window
+	if interval > time.Second {
+		interval = time.Second
+	}
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+				d.sweep(false)
+			}
+		}
+	}()
+}
+
+// Stop 停止过滤插件，等待窗口结束的事件立即发出
+func (d *DedupFilter) Stop() {
+	d.halt()
+	d.release()
+}
+
+// halt 停止处理循环和定时清理，之后 drain 进来的事件仍然会记录
+func (d *DedupFilter) halt() {
+	if !d.IsRunning() {
+		return
+	}
+	close(d.stop)
+	d.stopLoop("DedupFilter")
+}
+
+// release 发出所有等待窗口结束的事件
+func (d *DedupFilter) release() {
+	d.sweep(true)
+}
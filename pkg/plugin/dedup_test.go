@@ -0,0 +1,109 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDedupSweep(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxEntries int
+		messages   []string
+		// expire 在 sweep 之前让前几条记录过期
+		expire  int
+		all     bool
+		want    []string
+		entries int
+	}{
+		{
+			name:     "stops at the first unexpired entry",
+			messages: []string{"a", "b", "a", "c"},
+			expire:   1,
+			want:     []string{"a"},
+			entries:  2,
+		},
+		{
+			name:     "releases expired entries in order",
+			messages: []string{"a", "b", "c", "b"},
+			expire:   2,
+			want:     []string{"a", "b"},
+			entries:  1,
+		},
+		{
+			name:     "all",
+			messages: []string{"a", "b", "c"},
+			all:      true,
+			want:     []string{"a", "b", "c"},
+		},
+		{
+			name:       "evicted entries are released once",
+			maxEntries: 2,
+			messages:   []string{"a", "b", "c"},
+			expire:     3,
+			want:       []string{"a", "b", "c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := NewQueue(10)
+			d, err := NewDedupFilter(NewQueue(10), out, "**", DedupOptions{
+				Keys:           []string{"message"},
+				Window:         time.Hour,
+				MaxEntries:     tt.maxEntries,
+				RepeatCountKey: "count",
+			})
+			if err != nil {
+				t.Fatalf("NewDedupFilter: %v", err)
+			}
+			for _, message := range tt.messages {
+				if event := d.Filter(NewEvent("app", map[string]interface{}{"message": message})); event != nil {
+					t.Fatalf("event %q passed before the window ended", message)
+				}
+			}
+			i := 0
+			for elem := d.expiry.Front(); elem != nil && i < tt.expire; elem = elem.Next() {
+				elem.Value.(*dedupEntry).expires = time.Now().Add(-time.Second)
+				i++
+			}
+
+			d.sweep(tt.all)
+			var got []string
+			for {
+				event, ok := out.Get()
+				if !ok {
+					break
+				}
+				got = append(got, event.Record["message"].(string))
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("released %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("released %v, want %v", got, tt.want)
+				}
+			}
+			if d.entries.Len() != tt.entries || d.expiry.Len() != tt.entries {
+				t.Errorf("entries = %d, expiry = %d, want %d", d.entries.Len(), d.expiry.Len(), tt.entries)
+			}
+		})
+	}
+}
+
+func TestDedupFilterStopWithRewrittenEvents(t *testing.T) {
+	events := runStopPipeline(t, func(in, out *Queue) FilterPlugin {
+		d, err := NewDedupFilter(in, out, "rewritten", DedupOptions{Window: time.Hour, RepeatCountKey: "count"})
+		if err != nil {
+			t.Fatalf("NewDedupFilter: %v", err)
+		}
+		d.Start()
+		return d
+	}, map[string]interface{}{"level": "ERROR", "message": "disk full"}, 100)
+	if len(events) != 1 {
+		t.Fatalf("routed %d events, want the deduplicated event", len(events))
+	}
+	if count := events[0].Record["count"]; count != int64(100) {
+		t.Errorf("count = %v, want 100", count)
+	}
+}
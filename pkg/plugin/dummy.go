@@ -0,0 +1,212 @@
+package plugin
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// minDummyInterval 生成批次的最短间隔，速率更高时需要增大 size
+const minDummyInterval = time.Millisecond
+
+// dummyPlaceholder 匹配记录模板中的占位符：
+// ${counter}、${random:min:max}、${choice:a|b|c} 和 ${uuid}
+var dummyPlaceholder = regexp.MustCompile(`\$\{(counter|uuid|random:(-?\d+):(-?\d+)|choice:([^}]*))\}`)
+
+// DummyInput 按固定速率生成样例事件的输入插件，用于压测和验证路由配置。
+// 多条记录时依次轮换，字符串值中的占位符每次生成时替换
+type DummyInput struct {
+	*BaseInput
+	records          []map[string]interface{}
+	rate             float64
+	size             int
+	interval         time.Duration
+	count            int64
+	autoIncrementKey *RecordAccessor
+	counter          int64
+	emitted          int64
+	dropped          int64
+	stop             chan struct{}
+}
+
+// NewDummyInput 创建一个新的 dummy 输入插件，rate 为每秒事件数，
+// size 为每批生成的事件数，count 为总事件数 (0 表示不限)
+func NewDummyInput(tag string, outputQueue *Queue, records []map[string]interface{}, rate float64, size int, count int64, autoIncrementKey string) (*DummyInput, error) {
+	if len(records) == 0 {
+		records = []map[string]interface{}{{"message": "dummy"}}
+	}
+	if rate <= 0 {
+		rate = 1
+	}
+	if size <= 0 {
+		size = 1
+	}
+	interval := time.Duration(float64(size) / rate * float64(time.Second))
+	if interval < minDummyInterval {
+		log.Printf("DummyInput: rate %g with size %d needs batches more often than every %v, the rate is limited to %g events/s",
+			rate, size, minDummyInterval, float64(size)/minDummyInterval.Seconds())
+		interval = minDummyInterval
+	}
+	input := &DummyInput{
+		BaseInput: NewBaseInput(tag, outputQueue),
+		records:   records,
+		rate:      rate,
+		size:      size,
+		interval:  interval,
+		count:     count,
+	}
+	if autoIncrementKey != "" {
+		accessor, err := NewRecordAccessor(autoIncrementKey)
+		if err != nil {
+			return nil, err
+		}
+		input.autoIncrementKey = accessor
+	}
+	return input, nil
+}
+
+// next 生成下一条记录，返回 false 表示已达到总数
+func (d *DummyInput) next() (map[string]interface{}, bool) {
+	n := atomic.AddInt64(&d.counter, 1) - 1
+	if d.count > 0 && n >= d.count {
+		return nil, false
+	}
+
+	template := d.records[n%int64(len(d.records))]
+	record := renderDummyValue(template, n).(map[string]interface{})
+	if d.autoIncrementKey != nil {
+		d.autoIncrementKey.Set(record, n)
+	}
+	return record, true
+}
+
+// emitBatch 生成一批事件，返回 false 表示已达到总数
+func (d *DummyInput) emitBatch() bool {
+	for i := 0; i < d.size; i++ {
+		record, ok := d.next()
+		if !ok {
+			return false
+		}
+		if d.outputQueue.Put(d.inject(NewEvent(d.tag, record), "", "")) {
+			atomic.AddInt64(&d.emitted, 1)
+		} else {
+			atomic.AddInt64(&d.dropped, 1)
+		}
+	}
+	return true
+}
+
+func (d *DummyInput) Start() {
+	if d.IsRunning() {
+		return
+	}
+
+	d.SetRunning(true)
+	d.stop = make(chan struct{})
+	d.BaseInput.wg.Add(1)
+
+	go func() {
+		defer d.BaseInput.wg.Done()
+		log.Printf("Starting DummyInput with tag %s at %g events/s", d.tag, d.rate)
+
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+
+		for {
+			if !d.emitBatch() {
+				log.Printf("DummyInput with tag %s reached count %d", d.tag, d.count)
+				return
+			}
+
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (d *DummyInput) Stop() {
+	if !d.IsRunning() {
+		return
+	}
+
+	d.SetRunning(false)
+	close(d.stop)
+	d.BaseInput.wg.Wait()
+	log.Printf("Stopped DummyInput with tag %s: %d events emitted, %d dropped because the queue was full",
+		d.tag, atomic.LoadInt64(&d.emitted), atomic.LoadInt64(&d.dropped))
+}
+
+// renderDummyValue 深拷贝模板并替换其中的占位符
+func renderDummyValue(value interface{}, counter int64) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		record := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			record[key] = renderDummyValue(item, counter)
+		}
+		return record
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = renderDummyValue(item, counter)
+		}
+		return list
+	case string:
+		// 整个字符串只有一个数值占位符时保留数值类型
+		if loc := dummyPlaceholder.FindStringIndex(v); loc != nil && loc[0] == 0 && loc[1] == len(v) {
+			if n, ok := renderDummyPlaceholder(v, counter).(int64); ok {
+				return n
+			}
+		}
+		return dummyPlaceholder.ReplaceAllStringFunc(v, func(placeholder string) string {
+			return fmt.Sprint(renderDummyPlaceholder(placeholder, counter))
+		})
+	}
+	return value
+}
+
+func renderDummyPlaceholder(placeholder string, counter int64) interface{} {
+	match := dummyPlaceholder.FindStringSubmatch(placeholder)
+	switch {
+	case match[1] == "counter":
+		return counter
+	case match[1] == "uuid":
+		return newUUID()
+	case strings.HasPrefix(match[1], "random:"):
+		min, _ := strconv.ParseInt(match[2], 10, 64)
+		max, _ := strconv.ParseInt(match[3], 10, 64)
+		if max < min {
+			min, max = max, min
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(max-min+1))
+		if err != nil {
+			return min
+		}
+		return min + n.Int64()
+	default:
+		choices := strings.Split(match[4], "|")
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(choices))))
+		if err != nil {
+			return choices[0]
+		}
+		return choices[n.Int64()]
+	}
+}
+
+// newUUID 生成一个随机的 UUID v4
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,49 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDummyInputInterval(t *testing.T) {
+	tests := []struct {
+		name string
+		rate float64
+		size int
+		want time.Duration
+	}{
+		{name: "default", want: time.Second},
+		{name: "batches", rate: 100, size: 10, want: 100 * time.Millisecond},
+		{name: "high rate", rate: 1e12, want: minDummyInterval},
+		{name: "rate truncated to zero", rate: 1e300, size: 1, want: minDummyInterval},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewDummyInput("dummy", NewQueue(10), nil, tt.rate, tt.size, 3, "")
+			if err != nil {
+				t.Fatalf("NewDummyInput: %v", err)
+			}
+			if d.interval != tt.want {
+				t.Errorf("interval = %v, want %v", d.interval, tt.want)
+			}
+		})
+	}
+}
+
+func TestDummyInputHighRate(t *testing.T) {
+	out := NewQueue(10)
+	d, err := NewDummyInput("dummy", out, nil, 1e300, 1, 3, "")
+	if err != nil {
+		t.Fatalf("NewDummyInput: %v", err)
+	}
+	d.Start()
+	defer d.Stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for out.Len() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("emitted %d events, want 3", out.Len())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -6,9 +6,14 @@ import (
 
 // a log event
 type Event struct {
-	Tag       string
+	Tag string
+	// Timestamp 事件时间，纳秒精度，与 Fluentd 的 EventTime 对应。
+	// NewEvent 设为当前时间，输入插件和 event_time 过滤插件可以用日志中的时间覆盖
 	Timestamp time.Time
 	Record    map[string]interface{}
+
+	// rewrites 事件被 rewrite_tag 重新发出的次数，用于防止无限循环
+	rewrites int
 }
 
 // NewEvent create a new event
@@ -19,3 +24,31 @@ func NewEvent(tag string, record map[string]interface{}) *Event {
 		Record:    record,
 	}
 }
+
+// Copy returns a deep copy of the event
+func (e *Event) Copy() *Event {
+	return &Event{
+		Tag:       e.Tag,
+		Timestamp: e.Timestamp,
+		Record:    copyValue(e.Record).(map[string]interface{}),
+		rewrites:  e.rewrites,
+	}
+}
+
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[key] = copyValue(item)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = copyValue(item)
+		}
+		return list
+	}
+	return value
+}
@@ -0,0 +1,169 @@
+package plugin
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// strptimeDirectives strptime 指令对应的 Go 时间布局
+var strptimeDirectives = map[string]string{
+	"Y": "2006", "y": "06", "C": "20",
+	"m": "01", "-m": "1", "b": "Jan", "h": "Jan", "B": "January",
+	"d": "02", "-d": "2", "e": "_2", "j": "002",
+	"H": "15", "k": "15", "I": "03", "-I": "3", "l": "3",
+	"M": "04", "-M": "4", "S": "05", "-S": "5",
+	"p": "PM", "P": "pm",
+	"a": "Mon", "A": "Monday",
+	"z": "-0700", ":z": "-07:00", "Z": "MST",
+	"T": "15:04:05", "R": "15:04", "F": "2006-01-02", "D": "01/02/06",
+	"c": "Mon Jan _2 15:04:05 2006",
+	"%": "%",
+}
+
+// strptimeLayout 将 strptime 格式 (例如 %Y-%m-%dT%H:%M:%S.%L%z) 转换为 Go 时间布局。
+// 秒的小数部分 (%L、%N、%3N 等) 在解析时由 Go 自动识别，所以连同前面的 . 或 , 一起去掉
+func strptimeLayout(format string) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i == len(format)-1 {
+			b.WriteByte(format[i])
+			continue
+		}
+
+		j := i + 1
+		for j < len(format) && format[j] >= '0' && format[j] <= '9' {
+			j++
+		}
+		if j < len(format) && (format[j] == 'L' || format[j] == 'N') {
+			layout := b.String()
+			if strings.HasSuffix(layout, ".") || strings.HasSuffix(layout, ",") {
+				b.Reset()
+				b.WriteString(layout[:len(layout)-1])
+			}
+			i = j
+			continue
+		}
+
+		directive := format[i+1 : i+2]
+		if (directive == "-" || directive == ":") && i+2 < len(format) {
+			directive = format[i+1 : i+3]
+		}
+		if layout, ok := strptimeDirectives[directive]; ok {
+			b.WriteString(layout)
+			i += len(directive)
+			continue
+		}
+		b.WriteByte(format[i])
+	}
+	return b.String()
+}
+
+// loadTimezone 解析时区，支持 IANA 名称 (Asia/Shanghai)、UTC、local 和固定偏移 (+08:00、-0500)
+func loadTimezone(name string) (*time.Location, error) {
+	switch {
+	case strings.EqualFold(name, "local"):
+		return time.Local, nil
+	case strings.HasPrefix(name, "+") || strings.HasPrefix(name, "-"):
+		for _, layout := range []string{"-07:00", "-0700", "-07"} {
+			if t, err := time.Parse(layout, name); err == nil {
+				_, offset := t.Zone()
+				return time.FixedZone(name, offset), nil
+			}
+		}
+		return nil, fmt.Errorf("invalid timezone offset %q", name)
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %v", name, err)
+	}
+	return location, nil
+}
+
+// EventTimeOptions event_time 过滤插件的配置
+type EventTimeOptions struct {
+	// Key 时间字段，支持 record accessor 语法，默认为 time
+	Key string
+	// Formats 依次尝试的时间格式：unix、unix_ms、unix_us、unix_ns、strptime 格式或 Go 时间布局，
+	// 为空时按 RFC3339 解析字符串、按秒解析数字
+	Formats []string
+	// Timezone 时间字符串中没有时区时使用的时区，默认为 UTC
+	Timezone string
+	// KeepKey 为 true 时保留时间字段
+	KeepKey bool
+}
+
+// EventTimeFilter 用记录中的时间字段设置事件时间，例如重放旧日志文件时使用日志中的时间而不是读取时间。
+// 字段不存在或无法解析时事件时间保持不变
+type EventTimeFilter struct {
+	*BaseFilter
+	key      *RecordAccessor
+	formats  []string
+	location *time.Location
+	keepKey  bool
+}
+
+// NewEventTimeFilter 创建一个新的事件时间过滤插件
+func NewEventTimeFilter(inputQueue, outputQueue *Queue, matchTag string, opts EventTimeOptions) (*EventTimeFilter, error) {
+	if opts.Key == "" {
+		opts.Key = "time"
+	}
+	key, err := NewRecordAccessor(opts.Key)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.Formats) == 0 {
+		opts.Formats = []string{""}
+	}
+	e := &EventTimeFilter{
+		BaseFilter: NewBaseFilter(inputQueue, outputQueue, matchTag),
+		key:        key,
+		formats:    opts.Formats,
+		keepKey:    opts.KeepKey,
+	}
+	if opts.Timezone != "" {
+		if e.location, err = loadTimezone(opts.Timezone); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// Filter 执行过滤操作
+func (e *EventTimeFilter) Filter(event *Event) *Event {
+	value, ok := e.key.Get(event.Record)
+	if !ok || value == nil {
+		return event
+	}
+
+	if t, ok := value.(time.Time); ok {
+		event.Timestamp = t
+	} else {
+		var err error
+		for _, format := range e.formats {
+			if t, err = parseEventTime(value, format, e.location); err == nil {
+				event.Timestamp = t
+				break
+			}
+		}
+		if err != nil {
+			log.Printf("Error parsing time %v in %s: %v", value, event.Tag, err)
+			return event
+		}
+	}
+	if !e.keepKey {
+		e.key.Delete(event.Record)
+	}
+	return event
+}
+
+// Start 启动过滤插件
+func (e *EventTimeFilter) Start() {
+	e.startLoop("EventTimeFilter", e.Filter)
+}
+
+// Stop 停止过滤插件
+func (e *EventTimeFilter) Stop() {
+	e.stopLoop("EventTimeFilter")
+}
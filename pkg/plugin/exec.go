@@ -0,0 +1,195 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+const (
+	execMinBackoff = 1 * time.Second
+	execMaxBackoff = 60 * time.Second
+)
+
+// ExecInput 运行外部命令并将其标准输出按行解析为事件。
+// interval 大于 0 时每隔 interval 运行一次命令，否则作为常驻进程运行，
+// 进程退出后按指数退避重新启动。标准错误的每一行作为 stderrTag 的事件发出
+type ExecInput struct {
+	*BaseInput
+	command   string
+	interval  time.Duration
+	parser    Parser
+	stderrTag string
+	cancel    context.CancelFunc
+}
+
+// NewExecInput 创建一个新的 exec 输入插件
+func NewExecInput(tag string, outputQueue *Queue, command string, interval time.Duration, parser Parser, stderrTag string) *ExecInput {
+	if stderrTag == "" {
+		stderrTag = tag + ".stderr"
+	}
+	return &ExecInput{
+		BaseInput: NewBaseInput(tag, outputQueue),
+		command:   command,
+		interval:  interval,
+		parser:    parser,
+		stderrTag: stderrTag,
+	}
+}
+
+// readStdout 按行解析标准输出，解析失败的行记录日志后丢弃
+func (e *ExecInput) readStdout(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		record, t, err := e.parser.Parse(line)
+		if err != nil {
+			log.Printf("Error parsing output of %q: %v", e.command, err)
+			continue
+		}
+		event := NewEvent(e.tag, record)
+		if !t.IsZero() {
+			event.Timestamp = t
+		}
+		e.outputQueue.Put(e.inject(event, "", ""))
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("Error reading output of %q: %v", e.command, err)
+	}
+}
+
+func (e *ExecInput) readStderr(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" {
+			e.outputQueue.Put(e.inject(NewEvent(e.stderrTag, map[string]interface{}{
+				"message": line,
+				"command": e.command,
+			}), "", ""))
+		}
+	}
+}
+
+// run 运行一次命令，直到命令退出或 ctx 被取消
+func (e *ExecInput) run(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", e.command)
+	setProcessGroup(cmd)
+	// 进程被杀死后，其子进程可能仍持有管道，最多再等待一秒
+	cmd.WaitDelay = time.Second
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		e.readStdout(stdout)
+	}()
+	go func() {
+		defer wg.Done()
+		e.readStderr(stderr)
+	}()
+	wg.Wait()
+
+	return cmd.Wait()
+}
+
+// runInterval 每隔 interval 运行一次命令
+func (e *ExecInput) runInterval(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := e.run(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Command %q failed: %v", e.command, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runStreaming 持续运行命令，退出后按指数退避重启，稳定运行一段时间后重置退避
+func (e *ExecInput) runStreaming(ctx context.Context) {
+	backoff := execMinBackoff
+	for {
+		started := time.Now()
+		err := e.run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if time.Since(started) > execMaxBackoff {
+			backoff = execMinBackoff
+		}
+		log.Printf("Command %q exited (%v), restarting in %s", e.command, err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > execMaxBackoff {
+			backoff = execMaxBackoff
+		}
+	}
+}
+
+func (e *ExecInput) Start() {
+	if e.IsRunning() {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+
+	e.SetRunning(true)
+	e.BaseInput.wg.Add(1)
+
+	go func() {
+		defer e.BaseInput.wg.Done()
+		log.Printf("Starting ExecInput for %q with tag %s", e.command, e.tag)
+
+		if e.interval > 0 {
+			e.runInterval(ctx)
+		} else {
+			e.runStreaming(ctx)
+		}
+	}()
+}
+
+func (e *ExecInput) Stop() {
+	if !e.IsRunning() {
+		return
+	}
+
+	e.SetRunning(false)
+	// 取消 ctx 会杀死命令所在的整个进程组
+	e.cancel()
+	e.BaseInput.wg.Wait()
+	log.Printf("Stopped ExecInput for %q", e.command)
+}
@@ -0,0 +1,188 @@
+package plugin
+
+import (
+	"reflect"
+	"testing"
+)
+
+var testExpressionVariables = []string{"tag", "tag_parts", "record"}
+
+func testExpressionVars() map[string]interface{} {
+	return map[string]interface{}{
+		"tag":       "app.web",
+		"tag_parts": []interface{}{"app", "web"},
+		"record": map[string]interface{}{
+			"level":   "ERROR",
+			"latency": int64(1500),
+			"ratio":   0.25,
+			"user":    map[string]interface{}{"id": "u1", "roles": []interface{}{"admin", "dev"}},
+			"empty":   "",
+		},
+	}
+}
+
+func TestExpressionEval(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want interface{}
+	}{
+		// 字面量
+		{"integer", "42", int64(42)},
+		{"float", "1.5", 1.5},
+		{"double quoted", `"a\"b"`, `a"b`},
+		{"single quoted", `'a\nb'`, "a\nb"},
+		{"true", "true", true},
+		{"nil", "nil", nil},
+		{"null", "null", nil},
+
+		// 优先级和结合性
+		{"multiplication before addition", "1 + 2 * 3", int64(7)},
+		{"parentheses", "(1 + 2) * 3", int64(9)},
+		{"left associative", "10 - 4 - 3", int64(3)},
+		{"unary minus", "-3 + 1", int64(-2)},
+		{"double negation", "--2", int64(2)},
+		{"not binds tighter than or", "!true || true", true},
+		{"and before or", "true || false && false", true},
+		{"comparison before equality", "1 < 2 == true", true},
+		{"arithmetic before comparison", "1 + 1 > 1", true},
+		{"nested ternary", "false ? 1 : true ? 2 : 3", int64(2)},
+		{"ternary condition", `record.level == "ERROR" ? "alert" : "info"`, "alert"},
+
+		// 算术
+		{"integer division", "8 / 2", int64(4)},
+		{"inexact division", "7 / 2", 3.5},
+		{"modulo", "7 % 3", int64(1)},
+		{"float modulo", "7.5 % 2", 1.5},
+		{"float arithmetic", "1.5 * 2", 3.0},
+		{"numeric field", "record.latency / 1000", 1.5},
+		{"string concatenation", `"a" + 1`, "a1"},
+		{"concatenation after addition", `1 + 2 + "x"`, "3x"},
+
+		// 比较
+		{"equal numbers of different types", "1 == 1.0", true},
+		{"number equals numeric string", `1 == "1"`, true},
+		{"string inequality", `"a" != "b"`, true},
+		{"numeric strings compare as numbers", `"10" < "9"`, false},
+		{"strings compare lexically", `"abc" < "abd"`, true},
+		{"less or equal", "record.latency <= 1500", true},
+		{"greater or equal", "record.ratio >= 0.5", false},
+		{"boolean is not a number", "true == 1", false},
+
+		// nil 和不存在的字段
+		{"nil equals nil", "nil == nil", true},
+		{"missing field", "record.missing", nil},
+		{"missing field is nil", "record.missing == nil", true},
+		{"nested missing field", `record.missing.deeper["x"]`, nil},
+		{"nil is not zero", "record.missing == 0", false},
+		{"nil is falsy", "!record.missing", true},
+		{"empty string is falsy", "record.empty ? 1 : 2", int64(2)},
+		{"index out of range", "tag_parts[5]", nil},
+
+		// 下标和字段
+		{"negative index", "tag_parts[-1]", "web"},
+		{"bracket field", `record["user"]["id"]`, "u1"},
+		{"dotted field", "record.user.roles[0]", "admin"},
+		{"computed index", "tag_parts[len(tag_parts) - 2]", "app"},
+
+		// 短路求值
+		{"and short circuit", "false && 1 / 0", false},
+		{"or short circuit", "true || 1 / 0", true},
+		{"and result", `record.level && "x"`, true},
+
+		// 函数
+		{"upcase", "upcase(tag)", "APP.WEB"},
+		{"downcase", `downcase("AB")`, "ab"},
+		{"trim", `trim("  a ")`, "a"},
+		{"len of array", "len(tag_parts)", int64(2)},
+		{"len of map", "len(record.user)", int64(2)},
+		{"len counts runes", `len("héllo")`, int64(5)},
+		{"len of nil", "len(record.missing)", int64(0)},
+		{"int", `int("42.9")`, int64(42)},
+		{"float", "float(1)", 1.0},
+		{"string", "string(record.ratio)", "0.25"},
+		{"contains", `contains(tag, "web")`, true},
+		{"replace", `replace(tag, ".", "-")`, "app-web"},
+		{"substr", `substr("hello", 1, 3)`, "ell"},
+		{"substr from end", `substr("hello", -3)`, "llo"},
+		{"substr past end", `substr("hello", 3, 10)`, "lo"},
+		{"default for missing", `default(record.missing, "x")`, "x"},
+		{"default for empty string", `default(record.empty, "x")`, "x"},
+		{"default keeps value", `default(record.level, "x")`, "ERROR"},
+		{"nested calls", `upcase(substr(tag_parts[1], 0, 1)) + substr(tag_parts[1], 1)`, "Web"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := CompileExpression(tt.expr, testExpressionVariables)
+			if err != nil {
+				t.Fatalf("CompileExpression(%q): %v", tt.expr, err)
+			}
+			got, err := expr.Eval(testExpressionVars())
+			if err != nil {
+				t.Fatalf("Eval(%q): %v", tt.expr, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Eval(%q) = %#v, want %#v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpressionEvalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{"integer division by zero", "1 / 0"},
+		{"integer modulo by zero", "1 % 0"},
+		{"float division by zero", "1.5 / 0"},
+		{"arithmetic on a string", `"a" - 1`},
+		{"arithmetic on nil", "record.missing * 2"},
+		{"negate a string", `-record.level`},
+		{"string array index", `tag_parts["a"]`},
+		{"int of a word", `int("abc")`},
+		{"float of a boolean", "float(true)"},
+		{"error inside a call", "upcase(1 / 0)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := CompileExpression(tt.expr, testExpressionVariables)
+			if err != nil {
+				t.Fatalf("CompileExpression(%q): %v", tt.expr, err)
+			}
+			if got, err := expr.Eval(testExpressionVars()); err == nil {
+				t.Errorf("Eval(%q) = %#v, want error", tt.expr, got)
+			}
+		})
+	}
+}
+
+func TestCompileExpressionErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{"empty", ""},
+		{"unknown variable", "hostname"},
+		{"unknown function", "reverse(tag)"},
+		{"too few arguments", "contains(tag)"},
+		{"too many arguments", "upcase(tag, tag)"},
+		{"unterminated string", `"abc`},
+		{"unexpected character", "tag @ 1"},
+		{"trailing tokens", "1 2"},
+		{"missing operand", "1 +"},
+		{"unclosed parenthesis", "(1 + 2"},
+		{"unclosed index", "tag_parts[0"},
+		{"missing ternary branch", "true ? 1"},
+		{"field name after dot", "record.1"},
+		{"invalid number", "1.2.3"},
+		{"missing comma", "contains(tag \"a\")"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := CompileExpression(tt.expr, testExpressionVariables); err == nil {
+				t.Errorf("CompileExpression(%q): want error", tt.expr)
+			}
+		})
+	}
+}
@@ -25,6 +25,7 @@ type FileObserver struct {
 	path     string
 	callback func(FileEvent)
 	running  bool
+	stop     chan struct{}
 	mu       sync.Mutex
 	wg       sync.WaitGroup
 	lastMod  map[string]time.Time
@@ -94,6 +95,7 @@ func (f *FileObserver) Start() {
 	}
 
 	f.running = true
+	f.stop = make(chan struct{})
 	f.wg.Add(1)
 
 	// 初始化最后修改时间
@@ -106,8 +108,10 @@ func (f *FileObserver) Start() {
 		ticker := time.NewTicker(1 * time.Second)
 		defer ticker.Stop()
 
-		for f.running {
+		for {
 			select {
+			case <-f.stop:
+				return
 			case <-ticker.C:
 				f.scan()
 			}
@@ -124,5 +128,6 @@ func (f *FileObserver) Stop() {
 	}
 
 	f.running = false
+	close(f.stop)
 	f.wg.Wait()
 }
@@ -1,8 +1,11 @@
 package plugin
 
 import (
+	"fmt"
 	"log"
+	"os"
 	"regexp"
+	"sort"
 	"sync"
 	"time"
 )
@@ -18,327 +21,407 @@ type BaseFilter struct {
 	inputQueue  *Queue
 	outputQueue *Queue
 	matchTags   string
+	matcher     *TagMatcher
+	filter      func(*Event) *Event
 	running     bool
+	blocking    bool
 	mu          sync.Mutex
 	wg          sync.WaitGroup
 }
 
-/**
-type FilterRule struct {
-	Type    string            `yaml:"type"`
-	Tag     string            `yaml:"tag"`
-	Match   map[string]string `yaml:"match"`
-	Exclude map[string]string `yaml:"exclude"`
+// NewBaseFilter 创建一个新的基础过滤插件
+func NewBaseFilter(inputQueue, outputQueue *Queue, matchTag string) *BaseFilter {
+	return &BaseFilter{
+		inputQueue:  inputQueue,
+		outputQueue: outputQueue,
+		matchTags:   matchTag,
+		matcher:     NewTagMatcher(matchTag),
+		running:     false,
+	}
 }
 
-func (f *FilterRule) Evaluate(record map[string]interface{}) bool {
-	if len(f.Match) > 0 {
-		matchResult := f.evaluateMatchs(f.Match, record)
-		if !matchResult {
-			if f.Type == "match" {
-				return false
-			}
-		}
-	}
-	if len(f.Exclude) > 0 {
-		excludeResult := f.evaluateMatchs(f.Exclude, record)
-		if excludeResult {
-			if f.Type == "exclude" {
-				return false
-			}
-		}
-	}
-	return true
+// IsRunning 检查插件是否在运行
+func (f *BaseFilter) IsRunning() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.running
 }
 
-func (f *FilterRule) evaluateMatchs(matchers map[string]string, record map[string]interface{}) bool {
-	for key, pattern := range matchers {
-		value, exists := record[key]
-		if !exists {
-			return false
-		}
-		operator, target := parseOperator(pattern)
-		if !f.checkCondition(value, operator, target) {
-			return false
-		}
-	}
-	return true
+// SetRunning 设置插件运行状态
+func (f *BaseFilter) SetRunning(running bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.running = running
 }
 
-func parseOperator(pattern string) (string, string) {
-	operators := []string{">=", "<=", "!~", "~", "!=", ">", "<", "="}
+// SetBlocking 设置输出队列满时是否等待下游消费，一次性管道 (stdin 输入) 不能丢事件时使用
+func (f *BaseFilter) SetBlocking(blocking bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.blocking = blocking
+}
 
-	for _, op := range operators {
-		if len(pattern) > len(op) && pattern[:len(op)] == op {
-			return op, pattern[len(op):]
-		}
+func (f *BaseFilter) isBlocking() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.blocking
+}
+
+// put 将事件放入输出队列，blocking 时队列满等待下游消费，直到过滤插件停止
+func (f *BaseFilter) put(event *Event) bool {
+	if f.isBlocking() {
+		return f.outputQueue.putWait(event, f.IsRunning)
 	}
-	return "=", pattern
+	return f.outputQueue.Put(event)
 }
 
-func (f *FilterRule) checkCondition(value interface{}, operator, target string) bool {
+// Matches 检查事件标签是否匹配
+func (f *BaseFilter) Matches(tag string) bool {
+	return f.matcher.Match(tag)
+}
 
-	switch v := value.(type) {
-	case string:
-		return f.checkStringCondition(v, operator, target)
-	default:
-		return false
+// startLoop 启动处理循环，匹配标签的事件交给 filter 处理，不匹配的事件直接传递
+func (f *BaseFilter) startLoop(name string, filter func(*Event) *Event) {
+	if f.IsRunning() {
+		return
 	}
-}
 
-func (f *FilterRule) checkStringCondition(value, operator, target string) bool {
-	switch operator {
-	case "=":
-		return value == target
-	case "!=":
-		return value != target
-	case "~":
-		matched, _ := regexp.MatchString(target, value)
-		return matched
-	case "!~":
-		matched, _ := regexp.MatchString(target, value)
-		return !matched
-	case "in":
-		for _, t := range splitTarget(target) {
-			if value == t {
-				return true
+	f.filter = filter
+	f.SetRunning(true)
+	f.wg.Add(1)
+
+	go func() {
+		defer f.wg.Done()
+		log.Printf("Starting %s", name)
+
+		for f.IsRunning() {
+			event, ok := f.inputQueue.Get()
+			if !ok {
+				// 队列已关闭或无数据，短暂休眠
+				time.Sleep(100 * time.Millisecond)
+				continue
 			}
+			f.process(event)
 		}
-		return false
-	default:
-		return false
-	}
+	}()
 }
 
-func splitTarget(target string) []string {
-	var result []string
-	start := 0
-	inQuotes := false
-
-	for i, c := range target {
-		if c == '"' {
-			inQuotes = !inQuotes
-		} else if c == ',' && !inQuotes {
-			if i > start {
-				result = append(result, trimQuotes(target[start:i]))
-			}
-			start = i + 1
+// process 匹配标签的事件交给 filter 处理，不匹配的事件直接传递
+func (f *BaseFilter) process(event *Event) {
+	if f.Matches(event.Tag) {
+		filteredEvent := f.filter(event)
+		if filteredEvent != nil {
+			f.put(filteredEvent)
 		}
+	} else {
+		// 不匹配的事件直接传递
+		f.put(event)
 	}
+}
 
-	if start < len(target) {
-		result = append(result, trimQuotes(target[start:]))
+// stopLoop 停止处理循环并等待其退出，然后处理完输入队列中剩余的事件
+func (f *BaseFilter) stopLoop(name string) {
+	if !f.IsRunning() {
+		return
 	}
 
-	return result
+	f.SetRunning(false)
+	f.wg.Wait()
+	f.drain()
+	log.Printf("Stopped %s", name)
 }
 
-// 去除引号
-func trimQuotes(s string) string {
-	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
-		return s[1 : len(s)-1]
+// drain 处理完输入队列中剩余的事件，有事件被处理时返回 true。
+// 停止后由 Fluentd 调用，处理 rewrite_tag 在停止过程中放回入口的事件
+func (f *BaseFilter) drain() bool {
+	drained := false
+	for {
+		event, ok := f.inputQueue.Get()
+		if !ok {
+			return drained
+		}
+		f.process(event)
+		drained = true
 	}
-	return s
 }
-**/
-// NewBaseFilter 创建一个新的基础过滤插件
-func NewBaseFilter(inputQueue, outputQueue *Queue, matchTag string) *BaseFilter {
-	return &BaseFilter{
-		inputQueue:  inputQueue,
-		outputQueue: outputQueue,
-		matchTags:   matchTag,
-		running:     false,
-	}
+
+// GrepRule 一条 grep 规则，key 支持 record accessor 语法，
+// pattern 可以写成 /regex/ 的形式
+type GrepRule struct {
+	Key     string
+	Pattern string
 }
 
-// IsRunning 检查插件是否在运行
-func (f *BaseFilter) IsRunning() bool {
-	f.mu.Lock()
-	defer f.mu.Unlock()
-	return f.running
+// GrepRules 一组 regexp 和 exclude 规则
+type GrepRules struct {
+	Regexp  []GrepRule
+	Exclude []GrepRule
 }
 
-// SetRunning 设置插件运行状态
-func (f *BaseFilter) SetRunning(running bool) {
-	f.mu.Lock()
-	defer f.mu.Unlock()
-	f.running = running
+// GrepOptions grep 过滤插件的配置，语义与 Fluentd 的 filter_grep 一致：
+// 顶层的 regexp 需要全部匹配，顶层的 exclude 任意一个匹配即丢弃；
+// And 中的 regexp 需要全部匹配，exclude 全部匹配才丢弃；
+// Or 中的 regexp 任意一个匹配即可，exclude 任意一个匹配即丢弃
+type GrepOptions struct {
+	GrepRules
+	And []GrepRules
+	Or  []GrepRules
 }
 
-// Matches 检查事件标签是否匹配
-func (f *BaseFilter) Matches(tag string) bool {
-	// for _, pattern := range f.matchTags {
-	// 简单的通配符匹配，*匹配任意字符
-	// if f.matchTags == "*" {
-	// 	return true
-	// }
-	// if pattern[len(pattern)-1] == '*' && len(tag) >= len(pattern)-1 &&
-	// 	tag[:len(pattern)-1] == pattern[:len(pattern)-1] {
-	// 	return true
-	// }
-	// if tag == pattern {
-	// 	return true
-	// }
-	// }
-	return true
+type grepMatcher struct {
+	key     *RecordAccessor
+	pattern *regexp.Regexp
+}
+
+// grepGroup 一组规则，all 为 true 时要求全部匹配，否则任意一个匹配即可
+type grepGroup struct {
+	matchers []grepMatcher
+	all      bool
+}
+
+func (g grepGroup) match(record map[string]interface{}) bool {
+	for _, m := range g.matchers {
+		value, ok := m.key.Get(record)
+		matched := ok && value != nil && m.pattern.MatchString(toString(value))
+		if matched && !g.all {
+			return true
+		}
+		if !matched && g.all {
+			return false
+		}
+	}
+	return g.all
 }
 
 // GrepFilter 基于正则表达式过滤事件
 type GrepFilter struct {
 	*BaseFilter
-	key     string
-	pattern *regexp.Regexp
-	exclude bool
+	regexps  []grepGroup
+	excludes []grepGroup
 }
 
-// NewGrepFilter 创建一个新的Grep过滤插件
-func NewGrepFilter(inputQueue, outputQueue *Queue, matchTag string, key, pattern string, exclude bool) *GrepFilter {
-	return &GrepFilter{
+// NewGrepFilter 创建一个新的Grep过滤插件，规则的 key 或 pattern 无效时返回错误
+func NewGrepFilter(inputQueue, outputQueue *Queue, matchTag string, opts GrepOptions) (*GrepFilter, error) {
+	g := &GrepFilter{
 		BaseFilter: NewBaseFilter(inputQueue, outputQueue, matchTag),
-		key:        key,
-		pattern:    regexp.MustCompile(pattern),
-		exclude:    exclude,
 	}
-}
 
-// Filter 执行过滤操作
-func (g *GrepFilter) Filter(event *Event) *Event {
-	value, ok := event.Record[g.key].(string)
-	if !ok {
-		// 如果字段不存在或不是字符串，根据exclude决定是否保留
-		if g.exclude {
-			return event
+	add := func(groups *[]grepGroup, rules []GrepRule, all bool) error {
+		if len(rules) == 0 {
+			return nil
 		}
+		group := grepGroup{all: all}
+		for _, rule := range rules {
+			matcher, err := newGrepMatcher(rule)
+			if err != nil {
+				return err
+			}
+			group.matchers = append(group.matchers, matcher)
+		}
+		*groups = append(*groups, group)
 		return nil
 	}
 
-	match := g.pattern.MatchString(value)
-
-	// 根据exclude决定是否保留匹配的事件
-	if (match && !g.exclude) || (!match && g.exclude) {
-		return event
+	if err := add(&g.regexps, opts.Regexp, true); err != nil {
+		return nil, err
+	}
+	if err := add(&g.excludes, opts.Exclude, false); err != nil {
+		return nil, err
+	}
+	for _, rules := range opts.And {
+		if err := add(&g.regexps, rules.Regexp, true); err != nil {
+			return nil, err
+		}
+		if err := add(&g.excludes, rules.Exclude, true); err != nil {
+			return nil, err
+		}
+	}
+	for _, rules := range opts.Or {
+		if err := add(&g.regexps, rules.Regexp, false); err != nil {
+			return nil, err
+		}
+		if err := add(&g.excludes, rules.Exclude, false); err != nil {
+			return nil, err
+		}
 	}
 
-	return nil
+	if len(g.regexps) == 0 && len(g.excludes) == 0 {
+		return nil, fmt.Errorf("grep filter requires at least one regexp or exclude rule")
+	}
+	return g, nil
 }
 
-// Start 启动过滤插件
-func (g *GrepFilter) Start() {
-	if g.IsRunning() {
-		return
+func newGrepMatcher(rule GrepRule) (grepMatcher, error) {
+	if rule.Key == "" {
+		return grepMatcher{}, fmt.Errorf("grep rule requires a key")
+	}
+	key, err := NewRecordAccessor(rule.Key)
+	if err != nil {
+		return grepMatcher{}, err
 	}
 
-	g.SetRunning(true)
-	g.BaseFilter.wg.Add(1)
-
-	go func() {
-		defer g.BaseFilter.wg.Done()
-		log.Println("Starting GrepFilter")
-
-		for g.IsRunning() {
-			event, ok := g.inputQueue.Get()
-			if !ok {
-				// 队列已关闭或无数据，短暂休眠
-				time.Sleep(100 * time.Millisecond)
-				continue
-			}
+	pattern := rule.Pattern
+	if len(pattern) >= 2 && pattern[0] == '/' && pattern[len(pattern)-1] == '/' {
+		pattern = pattern[1 : len(pattern)-1]
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return grepMatcher{}, fmt.Errorf("invalid pattern for %s: %v", rule.Key, err)
+	}
+	return grepMatcher{key: key, pattern: re}, nil
+}
 
-			if g.Matches(event.Tag) {
-				filteredEvent := g.Filter(event)
-				if filteredEvent != nil {
-					g.outputQueue.Put(filteredEvent)
-				}
-			} else {
-				// 不匹配的事件直接传递
-				g.outputQueue.Put(event)
-			}
+// Filter 执行过滤操作，字段不存在时视为不匹配
+func (g *GrepFilter) Filter(event *Event) *Event {
+	for _, group := range g.regexps {
+		if !group.match(event.Record) {
+			return nil
 		}
-	}()
+	}
+	for _, group := range g.excludes {
+		if group.match(event.Record) {
+			return nil
+		}
+	}
+	return event
+}
+
+// Start 启动过滤插件
+func (g *GrepFilter) Start() {
+	g.startLoop("GrepFilter", g.Filter)
 }
 
 // Stop 停止过滤插件
 func (g *GrepFilter) Stop() {
-	if !g.IsRunning() {
-		return
-	}
+	g.stopLoop("GrepFilter")
+}
 
-	g.SetRunning(false)
-	g.BaseFilter.wg.Wait()
-	log.Println("Stopped GrepFilter")
+// RecordTransformerOptions record_transformer 过滤插件的配置
+type RecordTransformerOptions struct {
+	// Record 要写入的字段，key 支持 record accessor 语法，字符串值中可以使用 ${...} 占位符
+	Record map[string]interface{}
+	// RemoveKeys 最后删除的字段
+	RemoveKeys []string
+	// RenewRecord 为 true 时不保留原记录，只保留 KeepKeys 中的字段
+	RenewRecord bool
+	KeepKeys    []string
 }
 
-// RecordTransformerFilter 用于修改事件记录的过滤插件
+// RecordTransformerFilter 用于修改事件记录的过滤插件，
+// 占位符中的表达式可以使用 tag、tag_parts、tag_prefix、tag_suffix、hostname、time 和 record
 type RecordTransformerFilter struct {
 	*BaseFilter
-	addFields    map[string]interface{}
-	removeFields []string
+	fields      []transformField
+	removeKeys  []*RecordAccessor
+	keepKeys    []*RecordAccessor
+	renewRecord bool
+	hostname    string
 }
 
-// NewRecordTransformerFilter 创建一个新的记录转换过滤插件
-func NewRecordTransformerFilter(inputQueue, outputQueue *Queue, matchTags string, addFields map[string]interface{}, removeFields []string) *RecordTransformerFilter {
-	return &RecordTransformerFilter{
-		BaseFilter:   NewBaseFilter(inputQueue, outputQueue, matchTags),
-		addFields:    addFields,
-		removeFields: removeFields,
+type transformField struct {
+	key   *RecordAccessor
+	value *valueTemplate
+}
+
+// NewRecordTransformerFilter 创建一个新的记录转换过滤插件，字段名或占位符无效时返回错误
+func NewRecordTransformerFilter(inputQueue, outputQueue *Queue, matchTags string, opts RecordTransformerOptions) (*RecordTransformerFilter, error) {
+	hostname, _ := os.Hostname()
+	r := &RecordTransformerFilter{
+		BaseFilter:  NewBaseFilter(inputQueue, outputQueue, matchTags),
+		renewRecord: opts.RenewRecord,
+		hostname:    hostname,
 	}
+
+	// 按字段名排序，保证写入顺序稳定
+	keys := make([]string, 0, len(opts.Record))
+	for key := range opts.Record {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		accessor, err := NewRecordAccessor(key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := compileValueTemplate(opts.Record[key], transformVariables)
+		if err != nil {
+			return nil, fmt.Errorf("record %s: %v", key, err)
+		}
+		r.fields = append(r.fields, transformField{key: accessor, value: value})
+	}
+
+	for _, key := range opts.RemoveKeys {
+		accessor, err := NewRecordAccessor(key)
+		if err != nil {
+			return nil, err
+		}
+		r.removeKeys = append(r.removeKeys, accessor)
+	}
+	for _, key := range opts.KeepKeys {
+		accessor, err := NewRecordAccessor(key)
+		if err != nil {
+			return nil, err
+		}
+		r.keepKeys = append(r.keepKeys, accessor)
+	}
+	return r, nil
 }
 
-// Filter 执行记录转换操作
+var transformVariables = []string{"tag", "tag_parts", "tag_prefix", "tag_suffix", "hostname", "time", "record"}
+
+// Filter 执行记录转换操作，占位符中的 record 始终是转换前的原记录
 func (r *RecordTransformerFilter) Filter(event *Event) *Event {
-	// 添加字段
-	for key, value := range r.addFields {
-		event.Record[key] = value
+	vars := tagVariables(event.Tag)
+	vars["hostname"] = r.hostname
+	vars["time"] = event.Timestamp.Format(time.RFC3339)
+	vars["record"] = event.Record
+
+	record := event.Record
+	if r.renewRecord {
+		record = make(map[string]interface{})
+		for _, key := range r.keepKeys {
+			if value, ok := key.Get(event.Record); ok {
+				key.Set(record, value)
+			}
+		}
+	}
+
+	// 先计算所有字段再写入，避免后面的占位符读到前面写入的值。计算失败的字段不写入，保留原值
+	values := make([]interface{}, len(r.fields))
+	failed := make([]bool, len(r.fields))
+	for i, field := range r.fields {
+		value, err := field.value.render(vars)
+		if err != nil {
+			log.Printf("Error rendering field %s: %v", field.key, err)
+			failed[i] = true
+			continue
+		}
+		values[i] = value
+	}
+	for i, field := range r.fields {
+		if failed[i] {
+			continue
+		}
+		if err := field.key.Set(record, values[i]); err != nil {
+			log.Printf("Error setting field %s: %v", field.key, err)
+		}
 	}
 
 	// 移除字段
-	for _, key := range r.removeFields {
-		delete(event.Record, key)
+	for _, key := range r.removeKeys {
+		key.Delete(record)
 	}
 
+	event.Record = record
 	return event
 }
 
 // Start 启动过滤插件
 func (r *RecordTransformerFilter) Start() {
-	if r.IsRunning() {
-		return
-	}
-
-	r.SetRunning(true)
-	r.BaseFilter.wg.Add(1)
-
-	go func() {
-		defer r.BaseFilter.wg.Done()
-		log.Println("Starting RecordTransformerFilter")
-
-		for r.IsRunning() {
-			event, ok := r.inputQueue.Get()
-			if !ok {
-				// 队列已关闭或无数据，短暂休眠
-				time.Sleep(100 * time.Millisecond)
-				continue
-			}
-
-			if r.Matches(event.Tag) {
-				transformedEvent := r.Filter(event)
-				if transformedEvent != nil {
-					r.outputQueue.Put(transformedEvent)
-				}
-			} else {
-				// 不匹配的事件直接传递
-				r.outputQueue.Put(event)
-			}
-		}
-	}()
+	r.startLoop("RecordTransformerFilter", r.Filter)
 }
 
 // Stop 停止过滤插件
 func (r *RecordTransformerFilter) Stop() {
-	if !r.IsRunning() {
-		return
-	}
-
-	r.SetRunning(false)
-	r.BaseFilter.wg.Wait()
-	log.Println("Stopped RecordTransformerFilter")
+	r.stopLoop("RecordTransformerFilter")
 }
@@ -0,0 +1,46 @@
+package plugin
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRecordTransformerRenderFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   RecordTransformerOptions
+		record map[string]interface{}
+		want   map[string]interface{}
+	}{
+		{
+			name:   "failed field keeps the original value",
+			opts:   RecordTransformerOptions{Record: map[string]interface{}{"code": `${int(record["code"])}`, "ok": "yes"}},
+			record: map[string]interface{}{"code": "abc"},
+			want:   map[string]interface{}{"code": "abc", "ok": "yes"},
+		},
+		{
+			name:   "failed field is not added",
+			opts:   RecordTransformerOptions{Record: map[string]interface{}{"ratio": `${record["a"] / record["b"]}`}},
+			record: map[string]interface{}{"a": int64(1), "b": int64(0)},
+			want:   map[string]interface{}{"a": int64(1), "b": int64(0)},
+		},
+		{
+			name:   "failed field in renewed record",
+			opts:   RecordTransformerOptions{Record: map[string]interface{}{"n": `${int(record["n"])}`}, RenewRecord: true},
+			record: map[string]interface{}{"n": "abc"},
+			want:   map[string]interface{}{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRecordTransformerFilter(NewQueue(1), NewQueue(1), "**", tt.opts)
+			if err != nil {
+				t.Fatalf("NewRecordTransformerFilter: %v", err)
+			}
+			event := r.Filter(NewEvent("app", tt.record))
+			if !reflect.DeepEqual(event.Record, tt.want) {
+				t.Errorf("record = %v, want %v", event.Record, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package plugin
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultFlattenSeparator flatten 和 unflatten 过滤插件默认的字段名分隔符
+const DefaultFlattenSeparator = "."
+
+// FlattenOptions flatten 过滤插件的配置
+type FlattenOptions struct {
+	// Separator 拼接字段名的分隔符，默认为 .
+	Separator string
+	// MaxDepth 最多展开的层数，超过的部分保持嵌套，0 表示不限制
+	MaxDepth int
+}
+
+// FlattenFilter 把嵌套的 map 和数组展开成 a.b.c 形式的字段，数组下标作为字段名的一部分，
+// 例如 {a: {b: [1, 2]}} 展开为 {"a.b.0": 1, "a.b.1": 2}。空的 map 和数组原样保留。
+// 不同路径展开后得到相同的字段名时，层级浅的值优先，层级相同时路径按字典序靠前的优先，
+// 其余的值被丢弃
+type FlattenFilter struct {
+	*BaseFilter
+	separator  string
+	maxDepth   int
+	collisions atomic.Int64
+}
+
+// NewFlattenFilter 创建一个新的 flatten 过滤插件
+func NewFlattenFilter(inputQueue, outputQueue *Queue, matchTag string, opts FlattenOptions) (*FlattenFilter, error) {
+	if opts.Separator == "" {
+		opts.Separator = DefaultFlattenSeparator
+	}
+	return &FlattenFilter{
+		BaseFilter: NewBaseFilter(inputQueue, outputQueue, matchTag),
+		separator:  opts.Separator,
+		maxDepth:   opts.MaxDepth,
+	}, nil
+}
+
+type flattenLeaf struct {
+	path  []string
+	key   string
+	value interface{}
+}
+
+// collect 递归收集叶子节点，depth 为当前值所在的层级
+func (f *FlattenFilter) collect(path []string, value interface{}, depth int, leaves *[]flattenLeaf) {
+	expand := f.maxDepth <= 0 || depth <= f.maxDepth
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if expand && len(v) > 0 {
+			for key, item := range v {
+				f.collect(append(path[:len(path):len(path)], key), item, depth+1, leaves)
+			}
+			return
+		}
+	case []interface{}:
+		if expand && len(v) > 0 {
+			for i, item := range v {
+				f.collect(append(path[:len(path):len(path)], strconv.Itoa(i)), item, depth+1, leaves)
+			}
+			return
+		}
+	}
+	*leaves = append(*leaves, flattenLeaf{path: path, key: strings.Join(path, f.separator), value: value})
+}
+
+// Filter 展开记录中的嵌套字段
+func (f *FlattenFilter) Filter(event *Event) *Event {
+	var leaves []flattenLeaf
+	for key, value := range event.Record {
+		f.collect([]string{key}, value, 1, &leaves)
+	}
+
+	// 层级浅的优先，层级相同时按路径排序，保证冲突时的结果与 map 的遍历顺序无关
+	sort.Slice(leaves, func(i, j int) bool {
+		a, b := leaves[i].path, leaves[j].path
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return false
+	})
+
+	record := make(map[string]interface{}, len(leaves))
+	for _, leaf := range leaves {
+		if _, exists := record[leaf.key]; exists {
+			f.collisions.Add(1)
+			continue
+		}
+		record[leaf.key] = leaf.value
+	}
+	event.Record = record
+	return event
+}
+
+// Start 启动过滤插件
+func (f *FlattenFilter) Start() {
+	f.startLoop("FlattenFilter", f.Filter)
+}
+
+// Stop 停止过滤插件
+func (f *FlattenFilter) Stop() {
+	f.stopLoop("FlattenFilter")
+	if n := f.collisions.Load(); n > 0 {
+		log.Printf("FlattenFilter dropped %d values with colliding keys", n)
+	}
+}
+
+// UnflattenOptions unflatten 过滤插件的配置
+type UnflattenOptions struct {
+	// Separator 拆分字段名的分隔符，默认为 .
+	Separator string
+	// MaxDepth 最多拆分出的层数，剩余部分作为最后一层的字段名，0 表示不限制
+	MaxDepth int
+	// Arrays 为 true 时把字段名为连续下标 0..n-1 的 map 还原为数组
+	Arrays bool
+}
+
+// UnflattenFilter 把 a.b.c 形式的字段还原为嵌套的 map，是 flatten 的逆操作。
+// 字段按层级从浅到深、同层级按字典序处理，路径与已有的非 map 值冲突时该字段保持原样不拆分，
+// 例如 {"a": 1, "a.b": 2} 的结果不变
+type UnflattenFilter struct {
+	*BaseFilter
+	separator string
+	maxDepth  int
+	arrays    bool
+}
+
+// NewUnflattenFilter 创建一个新的 unflatten 过滤插件
+func NewUnflattenFilter(inputQueue, outputQueue *Queue, matchTag string, opts UnflattenOptions) (*UnflattenFilter, error) {
+	if opts.Separator == "" {
+		opts.Separator = DefaultFlattenSeparator
+	}
+	return &UnflattenFilter{
+		BaseFilter: NewBaseFilter(inputQueue, outputQueue, matchTag),
+		separator:  opts.Separator,
+		maxDepth:   opts.MaxDepth,
+		arrays:     opts.Arrays,
+	}, nil
+}
+
+func (u *UnflattenFilter) split(key string) []string {
+	if u.maxDepth > 0 {
+		return strings.SplitN(key, u.separator, u.maxDepth)
+	}
+	return strings.Split(key, u.separator)
+}
+
+// Filter 还原记录中的嵌套字段
+func (u *UnflattenFilter) Filter(event *Event) *Event {
+	type flatKey struct {
+		key  string
+		path []string
+	}
+	keys := make([]flatKey, 0, len(event.Record))
+	for key := range event.Record {
+		keys = append(keys, flatKey{key: key, path: u.split(key)})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i].path) != len(keys[j].path) {
+			return len(keys[i].path) < len(keys[j].path)
+		}
+		return keys[i].key < keys[j].key
+	})
+
+	record := make(map[string]interface{}, len(event.Record))
+	for _, k := range keys {
+		value := event.Record[k.key]
+		if len(k.path) > 1 && u.insert(record, k.path, value) {
+			continue
+		}
+		record[k.key] = value
+	}
+
+	if u.arrays {
+		for key, value := range record {
+			record[key] = u.restoreArrays(value)
+		}
+	}
+	event.Record = record
+	return event
+}
+
+// insert 按路径写入值，路径上存在非 map 值或叶子已存在时返回 false
+func (u *UnflattenFilter) insert(record map[string]interface{}, path []string, value interface{}) bool {
+	current := record
+	for _, segment := range path[:len(path)-1] {
+		next, exists := current[segment]
+		if !exists {
+			child := make(map[string]interface{})
+			current[segment] = child
+			current = child
+			continue
+		}
+		child, ok := next.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		current = child
+	}
+	last := path[len(path)-1]
+	if _, exists := current[last]; exists {
+		return false
+	}
+	current[last] = value
+	return true
+}
+
+// restoreArrays 把字段名为 0..n-1 的 map 转换为数组
+func (u *UnflattenFilter) restoreArrays(value interface{}) interface{} {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	for key, item := range m {
+		m[key] = u.restoreArrays(item)
+	}
+	if len(m) == 0 {
+		return m
+	}
+	array := make([]interface{}, len(m))
+	for key, item := range m {
+		index, err := strconv.Atoi(key)
+		if err != nil || index < 0 || index >= len(m) || strconv.Itoa(index) != key {
+			return m
+		}
+		array[index] = item
+	}
+	return array
+}
+
+// Start 启动过滤插件
+func (u *UnflattenFilter) Start() {
+	u.startLoop("UnflattenFilter", u.Filter)
+}
+
+// Stop 停止过滤插件
+func (u *UnflattenFilter) Stop() {
+	u.stopLoop("UnflattenFilter")
+}
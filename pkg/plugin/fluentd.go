@@ -2,8 +2,32 @@ package plugin
 
 import (
 	"sync"
+	"time"
 )
 
+// drainer 停止后还能同步处理输入队列中剩余事件的过滤插件
+type drainer interface {
+	drain() bool
+}
+
+// blocker 输出队列满时可以等待下游消费的过滤插件
+type blocker interface {
+	SetBlocking(blocking bool)
+}
+
+// parseErrorCounter 统计解析失败的行数的输入插件
+type parseErrorCounter interface {
+	ParseErrors() int64
+}
+
+// stagedStopper 停止后还持有资源或缓存事件的过滤插件，停止分为两步：
+// halt 停止处理循环，过滤插件仍然可以通过 drain 处理事件；release 释放资源并发出缓存的事件。
+// 单独调用 Stop 时两步依次执行，Fluentd 停止时在所有事件都处理完之后才调用 release
+type stagedStopper interface {
+	halt()
+	release()
+}
+
 // Fluentd 是日志处理系统的主结构
 type Fluentd struct {
 	inputs  []InputPlugin
@@ -47,6 +71,90 @@ func (f *Fluentd) AddOutput(output OutputPlugin) {
 	f.outputs = append(f.outputs, output)
 }
 
+// AddQueue 登记组件间的队列，停止时统一关闭，Drain 时检查是否为空
+func (f *Fluentd) AddQueue(queue *Queue) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queues = append(f.queues, queue)
+}
+
+// Drain 等待所有队列中的事件被处理完，超时返回 false。
+// 插件在队列为空时会休眠一段时间，所以需要连续几次检查都为空才认为已处理完
+func (f *Fluentd) Drain(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	idle := 0
+	for time.Now().Before(deadline) {
+		if f.queuesEmpty() {
+			idle++
+			if idle >= 3 {
+				return true
+			}
+		} else {
+			idle = 0
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return false
+}
+
+func (f *Fluentd) queuesEmpty() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, queue := range f.queues {
+		if queue.Len() > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Failures 返回所有输出插件刷新失败的总次数
+func (f *Fluentd) Failures() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	failures := 0
+	for _, output := range f.outputs {
+		failures += output.Failures()
+	}
+	return failures
+}
+
+// Dropped 返回所有队列因已满或已关闭而丢弃的事件总数
+func (f *Fluentd) Dropped() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var dropped int64
+	for _, queue := range f.queues {
+		dropped += queue.Dropped()
+	}
+	return dropped
+}
+
+// ParseErrors 返回所有输入插件解析失败的总行数
+func (f *Fluentd) ParseErrors() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var count int64
+	for _, input := range f.inputs {
+		if counter, ok := input.(parseErrorCounter); ok {
+			count += counter.ParseErrors()
+		}
+	}
+	return count
+}
+
+// SetBlocking 设置所有过滤插件和路由在输出队列满时是否等待下游消费，而不是丢弃事件。
+// rewrite_tag 放回入口的事件仍然不等待，否则入口和 rewrite_tag 互相等待时会死锁
+func (f *Fluentd) SetBlocking(blocking bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, filter := range f.filters {
+		if b, ok := filter.(blocker); ok {
+			b.SetBlocking(blocking)
+		}
+	}
+}
+
 // Start 启动所有组件
 func (f *Fluentd) Start() {
 	f.mu.Lock()
@@ -74,6 +182,19 @@ func (f *Fluentd) Start() {
 	}
 }
 
+// drainFilters 按顺序重复处理各个过滤插件输入队列中剩余的事件，直到没有新的事件为止。
+// rewrite_tag 停止前放回入口的事件还要经过前面已经停止的过滤插件，重写次数有上限，这个循环一定会结束
+func (f *Fluentd) drainFilters() {
+	for drained := true; drained; {
+		drained = false
+		for _, filter := range f.filters {
+			if d, ok := filter.(drainer); ok && d.drain() {
+				drained = true
+			}
+		}
+	}
+}
+
 // Stop 停止所有组件
 func (f *Fluentd) Stop() {
 	f.mu.Lock()
@@ -88,9 +209,23 @@ func (f *Fluentd) Stop() {
 		input.Stop()
 	}
 
-	// 再停止过滤
+	// 再按顺序停止过滤插件的处理循环，资源暂不释放
+	for _, filter := range f.filters {
+		if s, ok := filter.(stagedStopper); ok {
+			s.halt()
+		} else {
+			filter.Stop()
+		}
+	}
+	f.drainFilters()
+
+	// 所有事件处理完后按顺序释放资源，释放时发出的缓存事件 (例如 aggregate 最后一个窗口的汇总)
+	// 由后面还没有释放的过滤插件继续处理
 	for _, filter := range f.filters {
-		filter.Stop()
+		if s, ok := filter.(stagedStopper); ok {
+			s.release()
+			f.drainFilters()
+		}
 	}
 
 	// 最后停止输出，确保所有事件都被处理
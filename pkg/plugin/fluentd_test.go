@@ -0,0 +1,161 @@
+package plugin
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// startWithoutLoop 设置过滤函数并标记为运行中，但不启动处理循环，事件只在停止时的 drain 中处理
+func startWithoutLoop(f *BaseFilter, filter func(*Event) *Event) {
+	f.filter = filter
+	f.SetRunning(true)
+}
+
+// runStopPipeline 搭建 first → rewrite_tag → router 的流水线，rewrite_tag 把 app 标签的事件
+// 重写为 rewritten 放回入口，放入 total 个事件后停止，返回被路由的事件。
+// 过滤插件不启动处理循环，所有事件都在 Stop 中处理，结果与调度无关
+func runStopPipeline(t *testing.T, first func(in, out *Queue) FilterPlugin, record map[string]interface{}, total int) []*Event {
+	t.Helper()
+	entry, rewriteQueue, routerQueue, out := NewQueue(1000), NewQueue(1000), NewQueue(1000), NewQueue(1000)
+
+	rewrite, err := NewRewriteTagFilter(rewriteQueue, routerQueue, entry, "app", RewriteTagOptions{
+		Rules: []RewriteTagRule{{Key: "level", Pattern: "^ERROR$", Tag: "rewritten"}},
+	})
+	if err != nil {
+		t.Fatalf("NewRewriteTagFilter: %v", err)
+	}
+	startWithoutLoop(rewrite.BaseFilter, rewrite.Filter)
+	router := NewRouter(routerQueue)
+	router.AddRoute("rewritten", out)
+
+	fluent := NewFluentd()
+	fluent.AddFilter(first(entry, rewriteQueue))
+	fluent.AddFilter(rewrite)
+	fluent.AddFilter(router)
+	fluent.running = true
+
+	for i := 0; i < total; i++ {
+		entry.Put(NewEvent("app", copyValue(record).(map[string]interface{})))
+	}
+	fluent.Stop()
+
+	var events []*Event
+	for {
+		event, ok := out.Get()
+		if !ok {
+			return events
+		}
+		events = append(events, event)
+	}
+}
+
+// testStopPipeline 检查 runStopPipeline 中所有事件都再次经过 first 并被路由
+func testStopPipeline(t *testing.T, first func(in, out *Queue) FilterPlugin, record map[string]interface{}, check func(event *Event) bool) {
+	t.Helper()
+	const total = 100
+	events := runStopPipeline(t, first, record, total)
+	if n := len(events); n != total {
+		t.Fatalf("routed %d rewritten events, want %d", n, total)
+	}
+	for _, event := range events {
+		if event.Tag != "rewritten" || !check(event) {
+			t.Fatalf("event = %s %v, want tag rewritten processed by the first filter again", event.Tag, event.Record)
+		}
+	}
+}
+
+func TestFluentdStopKeepsRewrittenEvents(t *testing.T) {
+	testStopPipeline(t, func(in, out *Queue) FilterPlugin {
+		transformer, err := NewRecordTransformerFilter(in, out, "**", RecordTransformerOptions{
+			Record: map[string]interface{}{"seen": "${tag}"},
+		})
+		if err != nil {
+			t.Fatalf("NewRecordTransformerFilter: %v", err)
+		}
+		startWithoutLoop(transformer.BaseFilter, transformer.Filter)
+		return transformer
+	}, map[string]interface{}{"level": "ERROR"}, func(event *Event) bool {
+		return event.Record["seen"] == "rewritten"
+	})
+}
+
+func TestFluentdStopReleasesAfterDrain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	copyTestDatabase(t, "geoip-city-v1.mmdb", path, time.Now())
+
+	testStopPipeline(t, func(in, out *Queue) FilterPlugin {
+		g, err := NewGeoIPFilter(in, out, "rewritten", GeoIPOptions{
+			Path:    path,
+			Lookups: []GeoIPLookup{{Key: "client"}},
+		})
+		if err != nil {
+			t.Fatalf("NewGeoIPFilter: %v", err)
+		}
+		startWithoutLoop(g.BaseFilter, g.Filter)
+		return g
+	}, map[string]interface{}{"level": "ERROR", "client": "8.8.8.8"}, func(event *Event) bool {
+		geo, _ := event.Record["geoip"].(map[string]interface{})
+		return geo["city"] == "Mountain View"
+	})
+}
+
+func TestFluentdSetBlocking(t *testing.T) {
+	const total = 20
+	tests := []struct {
+		name     string
+		blocking bool
+		wait     time.Duration
+	}{
+		{name: "non-blocking", wait: 500 * time.Millisecond},
+		{name: "blocking", blocking: true, wait: 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, filtered, out := NewQueue(total), NewQueue(1), NewQueue(1)
+			transformer, err := NewRecordTransformerFilter(entry, filtered, "**", RecordTransformerOptions{
+				Record: map[string]interface{}{"seen": "yes"},
+			})
+			if err != nil {
+				t.Fatalf("NewRecordTransformerFilter: %v", err)
+			}
+			router := NewRouter(filtered)
+			router.AddRoute("**", out)
+
+			fluent := NewFluentd()
+			fluent.AddFilter(transformer)
+			fluent.AddFilter(router)
+			fluent.AddQueue(entry)
+			fluent.AddQueue(filtered)
+			fluent.AddQueue(out)
+			fluent.SetBlocking(tt.blocking)
+			for i := 0; i < total; i++ {
+				entry.Put(NewEvent("app", map[string]interface{}{"n": i}))
+			}
+
+			// 输出队列只能放一个事件，慢速消费
+			received := make(chan int)
+			go func() {
+				n := 0
+				deadline := time.Now().Add(tt.wait)
+				for n < total && time.Now().Before(deadline) {
+					if _, ok := out.Get(); ok {
+						n++
+					}
+					time.Sleep(time.Millisecond)
+				}
+				received <- n
+			}()
+			fluent.Start()
+			n := <-received
+			fluent.Stop()
+
+			if tt.blocking && (n != total || fluent.Dropped() != 0) {
+				t.Errorf("received %d events, dropped %d, want all %d received", n, fluent.Dropped(), total)
+			}
+			if !tt.blocking && fluent.Dropped() == 0 {
+				t.Error("non-blocking puts into a full queue dropped nothing")
+			}
+		})
+	}
+}
@@ -0,0 +1,387 @@
+package plugin
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang/v2"
+)
+
+// DefaultGeoIPCacheSize geoip 过滤插件默认缓存的 IP 数量
+const DefaultGeoIPCacheSize = 10000
+
+// DefaultGeoIPTarget 只有一个查询时结果默认写入的字段
+const DefaultGeoIPTarget = "geoip"
+
+// geoipReloadDelay 数据库文件最后一次变化后等待多久再重新加载，
+// 大于 FileObserver 的扫描间隔，文件还在写入时不会加载不完整的数据库
+const geoipReloadDelay = 3 * time.Second
+
+// DefaultGeoIPFields 没有配置 Fields 时写入的字段，数据库中不存在的字段会被忽略，
+// 因此同一份配置可以用于 City 和 ASN 数据库
+var DefaultGeoIPFields = map[string]string{
+	"country_code": "country.iso_code",
+	"country_name": "country.names.en",
+	"city":         "city.names.en",
+	"latitude":     "location.latitude",
+	"longitude":    "location.longitude",
+	"asn":          "autonomous_system_number",
+	"as_org":       "autonomous_system_organization",
+}
+
+// GeoIPLookup 一个要查询的 IP 字段，Key 和 Target 都支持 record accessor 语法
+type GeoIPLookup struct {
+	Key    string
+	Target string
+}
+
+// GeoIPOptions geoip 过滤插件的配置
+type GeoIPOptions struct {
+	// Path MaxMind 格式（.mmdb）的数据库文件，文件被替换后自动重新加载
+	Path string
+	// Lookups 要查询的 IP 字段，只有一个查询时 Target 默认为 geoip
+	Lookups []GeoIPLookup
+	// Fields 写入 Target 的字段到数据库中路径的映射，例如 {country: country.iso_code}，
+	// 路径用 . 分隔，数字表示数组下标，例如 subdivisions.0.iso_code
+	Fields map[string]string
+	// CacheSize 缓存查询结果的 IP 数量
+	CacheSize int
+}
+
+type geoipLookup struct {
+	key    *RecordAccessor
+	target *RecordAccessor
+}
+
+type geoipField struct {
+	key  *RecordAccessor
+	path []any
+}
+
+// geoipDatabase 一个版本的数据库和它的查询缓存，refs 为正在查询的数量，
+// 替换后等所有查询结束再关闭
+type geoipDatabase struct {
+	reader  *maxminddb.Reader
+	cache   *lruCache[netip.Addr, map[string]interface{}]
+	modTime time.Time
+	size    int64
+	refs    sync.WaitGroup
+}
+
+// GeoIPFilter 根据本地的 MaxMind 数据库查询 IP 字段的地理位置信息。
+// 字段不存在、不是合法 IP 或数据库中查不到时不写入 Target
+type GeoIPFilter struct {
+	*BaseFilter
+	path     string
+	lookups  []geoipLookup
+	fields   []geoipField
+	observer *FileObserver
+
+	cacheSize int
+	reloadMu  sync.Mutex
+	reloadAt  *time.Timer
+
+	dbMu sync.Mutex
+	db   *geoipDatabase
+}
+
+// NewGeoIPFilter 创建一个新的 geoip 过滤插件，数据库无法打开或配置无效时返回错误
+func NewGeoIPFilter(inputQueue, outputQueue *Queue, matchTag string, opts GeoIPOptions) (*GeoIPFilter, error) {
+	if opts.Path == "" {
+		return nil, fmt.Errorf("geoip filter requires a path")
+	}
+	if len(opts.Lookups) == 0 {
+		return nil, fmt.Errorf("geoip filter requires at least one lookup")
+	}
+	if len(opts.Fields) == 0 {
+		opts.Fields = DefaultGeoIPFields
+	}
+	if opts.CacheSize <= 0 {
+		opts.CacheSize = DefaultGeoIPCacheSize
+	}
+
+	g := &GeoIPFilter{
+		BaseFilter: NewBaseFilter(inputQueue, outputQueue, matchTag),
+		path:       filepath.Clean(opts.Path),
+		cacheSize:  opts.CacheSize,
+	}
+
+	for _, lookup := range opts.Lookups {
+		if lookup.Key == "" {
+			return nil, fmt.Errorf("geoip lookup requires a key")
+		}
+		if lookup.Target == "" {
+			if len(opts.Lookups) > 1 {
+				return nil, fmt.Errorf("geoip lookup for %s requires a target", lookup.Key)
+			}
+			lookup.Target = DefaultGeoIPTarget
+		}
+		key, err := NewRecordAccessor(lookup.Key)
+		if err != nil {
+			return nil, err
+		}
+		target, err := NewRecordAccessor(lookup.Target)
+		if err != nil {
+			return nil, err
+		}
+		g.lookups = append(g.lookups, geoipLookup{key: key, target: target})
+	}
+
+	// 按字段名排序，保证写入顺序稳定
+	names := make([]string, 0, len(opts.Fields))
+	for name := range opts.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		key, err := NewRecordAccessor(name)
+		if err != nil {
+			return nil, err
+		}
+		path, err := parseGeoIPPath(opts.Fields[name])
+		if err != nil {
+			return nil, fmt.Errorf("geoip field %s: %v", name, err)
+		}
+		g.fields = append(g.fields, geoipField{key: key, path: path})
+	}
+
+	db, err := g.open()
+	if err != nil {
+		return nil, fmt.Errorf("open geoip database %s: %v", opts.Path, err)
+	}
+	g.db = db
+
+	g.observer = NewFileObserver(filepath.Dir(g.path), func(event FileEvent) {
+		if event.Path == g.path && event.Type != FileEventDelete {
+			g.scheduleReload()
+		}
+	})
+	return g, nil
+}
+
+// open 打开数据库文件，记录文件的修改时间和大小用于判断是否需要重新加载
+func (g *GeoIPFilter) open() (*geoipDatabase, error) {
+	info, err := os.Stat(g.path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := maxminddb.Open(g.path)
+	if err != nil {
+		return nil, err
+	}
+	return &geoipDatabase{
+		reader:  reader,
+		cache:   newLRUCache[netip.Addr, map[string]interface{}](g.cacheSize),
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}, nil
+}
+
+// parseGeoIPPath 把 country.names.en 这样的路径转换成 DecodePath 的参数
+func parseGeoIPPath(path string) ([]any, error) {
+	if path == "" {
+		return nil, fmt.Errorf("empty database path")
+	}
+	var segments []any
+	for _, part := range strings.Split(path, ".") {
+		if part == "" {
+			return nil, fmt.Errorf("invalid database path %q", path)
+		}
+		if index, err := strconv.Atoi(part); err == nil {
+			segments = append(segments, index)
+		} else {
+			segments = append(segments, part)
+		}
+	}
+	return segments, nil
+}
+
+// scheduleReload 文件变化后延迟重新加载，延迟内再次变化时重新计时
+func (g *GeoIPFilter) scheduleReload() {
+	g.reloadMu.Lock()
+	defer g.reloadMu.Unlock()
+	if g.reloadAt != nil {
+		g.reloadAt.Reset(geoipReloadDelay)
+		return
+	}
+	g.reloadAt = time.AfterFunc(geoipReloadDelay, g.reload)
+}
+
+// reload 数据库文件被替换后重新打开，文件没有变化时不做任何事，失败时继续使用原来的数据库
+func (g *GeoIPFilter) reload() {
+	g.dbMu.Lock()
+	current := g.db
+	g.dbMu.Unlock()
+	if current == nil {
+		return
+	}
+	if info, err := os.Stat(g.path); err == nil && info.ModTime().Equal(current.modTime) && info.Size() == current.size {
+		return
+	}
+
+	db, err := g.open()
+	if err != nil {
+		log.Printf("Error reloading geoip database, keeping the previous version: %v", err)
+		return
+	}
+
+	g.dbMu.Lock()
+	old := g.db
+	if old == nil {
+		// 过滤插件已经停止
+		g.dbMu.Unlock()
+		db.reader.Close()
+		return
+	}
+	g.db = db
+	g.dbMu.Unlock()
+
+	old.refs.Wait()
+	old.reader.Close()
+	log.Printf("Reloaded geoip database %s (build %s)", g.path, db.reader.Metadata.BuildTime().UTC().Format("2006-01-02"))
+}
+
+// lookup 查询一个 IP，查不到时返回 nil。返回的结果是缓存中的对象，调用方不能修改。
+// 只在读写缓存时加锁，解码在锁外进行
+func (g *GeoIPFilter) lookup(addr netip.Addr) map[string]interface{} {
+	g.dbMu.Lock()
+	db := g.db
+	if db == nil {
+		g.dbMu.Unlock()
+		return nil
+	}
+	if result, ok := db.cache.Get(addr); ok {
+		g.dbMu.Unlock()
+		return result
+	}
+	db.refs.Add(1)
+	g.dbMu.Unlock()
+
+	result := g.decode(db.reader, addr)
+	db.refs.Done()
+
+	// 查不到的结果也缓存，避免内网地址反复查询
+	g.dbMu.Lock()
+	db.cache.Add(addr, result)
+	g.dbMu.Unlock()
+	return result
+}
+
+// decode 从数据库中读取配置的字段
+func (g *GeoIPFilter) decode(reader *maxminddb.Reader, addr netip.Addr) map[string]interface{} {
+	found := reader.Lookup(addr)
+	if err := found.Err(); err != nil {
+		log.Printf("Error looking up %s in geoip database: %v", addr, err)
+		return nil
+	}
+	if !found.Found() {
+		return nil
+	}
+	var result map[string]interface{}
+	for _, field := range g.fields {
+		var value interface{}
+		if err := found.DecodePath(&value, field.path...); err != nil || value == nil {
+			continue
+		}
+		if result == nil {
+			result = make(map[string]interface{})
+		}
+		if err := field.key.Set(result, normalizeGeoIPValue(value)); err != nil {
+			log.Printf("Error setting geoip field %s: %v", field.key, err)
+		}
+	}
+	return result
+}
+
+// normalizeGeoIPValue 把数据库中的各种整数类型统一成 int64，方便后面的插件处理
+func normalizeGeoIPValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	case float32:
+		return float64(v)
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeGeoIPValue(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeGeoIPValue(item)
+		}
+	}
+	return value
+}
+
+// Filter 查询每个 IP 字段并把结果写入对应的 Target
+func (g *GeoIPFilter) Filter(event *Event) *Event {
+	for _, lookup := range g.lookups {
+		raw, ok := lookup.key.Get(event.Record)
+		if !ok || raw == nil {
+			continue
+		}
+		addr, err := netip.ParseAddr(strings.TrimSpace(toString(raw)))
+		if err != nil {
+			continue
+		}
+		result := g.lookup(addr.Unmap())
+		if result == nil {
+			continue
+		}
+		if err := lookup.target.Set(event.Record, copyValue(result)); err != nil {
+			log.Printf("Error setting geoip target %s: %v", lookup.target, err)
+		}
+	}
+	return event
+}
+
+// Start 启动过滤插件
+func (g *GeoIPFilter) Start() {
+	if g.IsRunning() {
+		return
+	}
+	g.startLoop("GeoIPFilter", g.Filter)
+	g.observer.Start()
+}
+
+// Stop 停止过滤插件并关闭数据库
+func (g *GeoIPFilter) Stop() {
+	g.halt()
+	g.release()
+}
+
+// halt 停止处理循环和数据库文件的监听
+func (g *GeoIPFilter) halt() {
+	g.observer.Stop()
+	g.reloadMu.Lock()
+	if g.reloadAt != nil {
+		g.reloadAt.Stop()
+	}
+	g.reloadMu.Unlock()
+	g.stopLoop("GeoIPFilter")
+}
+
+// release 关闭数据库
+func (g *GeoIPFilter) release() {
+	g.dbMu.Lock()
+	db := g.db
+	g.db = nil
+	g.dbMu.Unlock()
+	if db != nil {
+		db.refs.Wait()
+		db.reader.Close()
+	}
+}
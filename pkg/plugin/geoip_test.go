@@ -0,0 +1,159 @@
+package plugin
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// copyTestDatabase 把 testdata 中的数据库复制到 path，先写临时文件再改名，与更新工具的做法一致
+func copyTestDatabase(t *testing.T, name, path string, modTime time.Time) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path+".tmp", modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGeoIPFilter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	copyTestDatabase(t, "geoip-city-v1.mmdb", path, time.Now().Add(-time.Hour))
+	g, err := NewGeoIPFilter(NewQueue(1), NewQueue(1), "**", GeoIPOptions{
+		Path:    path,
+		Lookups: []GeoIPLookup{{Key: "client"}, {Key: "$.server.ip", Target: "$.server.geo"}},
+	})
+	if err == nil {
+		t.Fatal("want error for multiple lookups without a target")
+	}
+	g, err = NewGeoIPFilter(NewQueue(1), NewQueue(1), "**", GeoIPOptions{
+		Path:    path,
+		Lookups: []GeoIPLookup{{Key: "client"}},
+	})
+	if err != nil {
+		t.Fatalf("NewGeoIPFilter: %v", err)
+	}
+	defer g.Stop()
+
+	tests := []struct {
+		client string
+		want   map[string]interface{}
+	}{
+		{"8.8.8.8", map[string]interface{}{
+			"city": "Mountain View", "country_code": "US", "country_name": "United States",
+			"latitude": 37.4, "longitude": -122.1, "asn": int64(15169),
+		}},
+		{"::ffff:8.8.8.8", map[string]interface{}{
+			"city": "Mountain View", "country_code": "US", "country_name": "United States",
+			"latitude": 37.4, "longitude": -122.1, "asn": int64(15169),
+		}},
+		{"10.0.0.1", nil},
+		{"not an ip", nil},
+	}
+	for _, tt := range tests {
+		event := g.Filter(NewEvent("app", map[string]interface{}{"client": tt.client}))
+		geo, ok := event.Record["geoip"].(map[string]interface{})
+		if tt.want == nil {
+			if ok {
+				t.Errorf("%s: unexpected geoip %v", tt.client, geo)
+			}
+			continue
+		}
+		for key, want := range tt.want {
+			if geo[key] != want {
+				t.Errorf("%s: geoip[%s] = %v, want %v", tt.client, key, geo[key], want)
+			}
+		}
+	}
+}
+
+func TestGeoIPReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	copyTestDatabase(t, "geoip-city-v1.mmdb", path, time.Now().Add(-time.Hour))
+	g, err := NewGeoIPFilter(NewQueue(1), NewQueue(1), "**", GeoIPOptions{
+		Path:    path,
+		Lookups: []GeoIPLookup{{Key: "client"}},
+		Fields:  map[string]string{"city": "city.names.en"},
+	})
+	if err != nil {
+		t.Fatalf("NewGeoIPFilter: %v", err)
+	}
+	defer g.Stop()
+	addr := netip.MustParseAddr("8.8.8.8")
+	city := func() interface{} { return g.lookup(addr)["city"] }
+
+	if got := city(); got != "Mountain View" {
+		t.Fatalf("city = %v", got)
+	}
+	first := g.db
+
+	// 文件没有变化时不重新打开
+	g.reload()
+	if g.db != first {
+		t.Fatal("reloaded an unchanged database")
+	}
+
+	// 替换过程中并发查询，旧的数据库在查询结束后才关闭
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					if got := city(); got != "Mountain View" && got != "Palo Alto" {
+						t.Errorf("city during reload = %v", got)
+						return
+					}
+				}
+			}
+		}()
+	}
+	copyTestDatabase(t, "geoip-city-v2.mmdb", path, time.Now())
+	g.reload()
+	close(stop)
+	wg.Wait()
+
+	if got := city(); got != "Palo Alto" {
+		t.Errorf("city after reload = %v, want Palo Alto", got)
+	}
+}
+
+func TestGeoIPScheduleReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	copyTestDatabase(t, "geoip-city-v1.mmdb", path, time.Now().Add(-time.Hour))
+	g, err := NewGeoIPFilter(NewQueue(1), NewQueue(1), "**", GeoIPOptions{
+		Path:    path,
+		Lookups: []GeoIPLookup{{Key: "client"}},
+	})
+	if err != nil {
+		t.Fatalf("NewGeoIPFilter: %v", err)
+	}
+
+	// 连续的变化只启动一个定时器，停止后不再重新加载
+	g.scheduleReload()
+	timer := g.reloadAt
+	g.scheduleReload()
+	if g.reloadAt != timer {
+		t.Error("scheduleReload created a second timer")
+	}
+	g.Stop()
+	if g.reloadAt.Stop() {
+		t.Error("reload timer still pending after Stop")
+	}
+}
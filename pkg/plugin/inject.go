@@ -0,0 +1,111 @@
+package plugin
+
+import (
+	"log"
+	"net"
+	"os"
+)
+
+// InjectOptions 输入和输出插件的 inject 配置，每一项是写入的字段名，支持 record accessor 语法，
+// 为空的项不写入
+type InjectOptions struct {
+	// HostnameKey 写入主机名
+	HostnameKey string
+	// Hostname 主机名，为空时使用 os.Hostname()
+	Hostname string
+	// InputTypeKey 写入产生事件的输入插件类型，例如 file、tcp
+	InputTypeKey string
+	// InputIDKey 写入产生事件的输入插件 ID
+	InputIDKey string
+	// PathKey 写入事件来源的文件路径，只有读取文件的输入插件有这个信息
+	PathKey string
+	// SourceIPKey 写入发送事件的客户端 IP，只有监听网络的输入插件有这个信息
+	SourceIPKey string
+	// EventIDKey 写入每个事件唯一的 UUID
+	EventIDKey string
+}
+
+// Injector 向事件记录写入主机、输入插件和来源等元数据，已有的同名字段会被覆盖。
+// nil 的 Injector 不做任何事，插件没有配置 inject 时不需要判断
+type Injector struct {
+	hostname     string
+	inputType    string
+	inputID      string
+	hostnameKey  *RecordAccessor
+	inputTypeKey *RecordAccessor
+	inputIDKey   *RecordAccessor
+	pathKey      *RecordAccessor
+	sourceIPKey  *RecordAccessor
+	eventIDKey   *RecordAccessor
+}
+
+// NewInjector 创建一个新的 Injector，inputType 和 inputID 为空时不写入对应的字段，
+// 输出插件使用时传入空字符串。字段名无效时返回错误
+func NewInjector(opts InjectOptions, inputType, inputID string) (*Injector, error) {
+	i := &Injector{
+		hostname:  opts.Hostname,
+		inputType: inputType,
+		inputID:   inputID,
+	}
+	if i.hostname == "" {
+		i.hostname, _ = os.Hostname()
+	}
+
+	keys := []struct {
+		name     string
+		accessor **RecordAccessor
+	}{
+		{opts.HostnameKey, &i.hostnameKey},
+		{opts.InputTypeKey, &i.inputTypeKey},
+		{opts.InputIDKey, &i.inputIDKey},
+		{opts.PathKey, &i.pathKey},
+		{opts.SourceIPKey, &i.sourceIPKey},
+		{opts.EventIDKey, &i.eventIDKey},
+	}
+	for _, key := range keys {
+		if key.name == "" {
+			continue
+		}
+		accessor, err := NewRecordAccessor(key.name)
+		if err != nil {
+			return nil, err
+		}
+		*key.accessor = accessor
+	}
+	return i, nil
+}
+
+// Inject 向事件写入元数据，path 和 sourceIP 为空时不写入对应的字段
+func (i *Injector) Inject(event *Event, path, sourceIP string) {
+	if i == nil {
+		return
+	}
+	if event.Record == nil {
+		event.Record = make(map[string]interface{})
+	}
+	i.set(event, i.hostnameKey, i.hostname)
+	i.set(event, i.inputTypeKey, i.inputType)
+	i.set(event, i.inputIDKey, i.inputID)
+	i.set(event, i.pathKey, path)
+	i.set(event, i.sourceIPKey, sourceIP)
+	if i.eventIDKey != nil {
+		i.set(event, i.eventIDKey, newUUID())
+	}
+}
+
+func (i *Injector) set(event *Event, key *RecordAccessor, value string) {
+	if key == nil || value == "" {
+		return
+	}
+	if err := key.Set(event.Record, value); err != nil {
+		log.Printf("Error injecting %s: %v", key, err)
+	}
+}
+
+// remoteIP 返回 TCP 连接对端的 IP，其他类型的连接（例如 unix socket）返回空字符串
+func remoteIP(conn net.Conn) string {
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP.String()
+	}
+	return ""
+}
@@ -7,6 +7,7 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
@@ -19,6 +20,7 @@ type InputPlugin interface {
 type BaseInput struct {
 	tag         string
 	outputQueue *Queue
+	injector    *Injector
 	running     bool
 	mu          sync.Mutex
 	wg          sync.WaitGroup
@@ -44,6 +46,17 @@ func (i *BaseInput) SetRunning(running bool) {
 	i.running = running
 }
 
+// SetInjector 设置写入元数据的 Injector，需要在 Start 之前调用
+func (i *BaseInput) SetInjector(injector *Injector) {
+	i.injector = injector
+}
+
+// inject 向事件写入 inject 配置的元数据，path 和 sourceIP 为事件来源，没有时传空字符串
+func (i *BaseInput) inject(event *Event, path, sourceIP string) *Event {
+	i.injector.Inject(event, path, sourceIP)
+	return event
+}
+
 type TailInput struct {
 	*BaseInput
 	path      string
@@ -52,9 +65,12 @@ type TailInput struct {
 	observer  *FileObserver
 }
 
+// NewTailInput 创建一个新的文件尾监听输入插件。tag 中的 * 会被替换为文件路径，
+// 路径中的 / 替换为 .，例如 path 为 /var/log/containers/app.log、tag 为 kubernetes.* 时
+// 事件的标签为 kubernetes.var.log.containers.app.log，kubernetes_metadata 可以从中解析 pod 信息
 func NewTailInput(tag string, outputQueue *Queue, path, posFile string) *TailInput {
 	input := &TailInput{
-		BaseInput: NewBaseInput(tag, outputQueue),
+		BaseInput: NewBaseInput(expandPathTag(tag, path), outputQueue),
 		path:      path,
 		posFile:   posFile,
 		positions: make(map[string]int64),
@@ -71,6 +87,15 @@ func NewTailInput(tag string, outputQueue *Queue, path, posFile string) *TailInp
 	return input
 }
 
+// expandPathTag 把 tag 中的 * 替换为去掉开头 / 并把 / 换成 . 的文件路径
+func expandPathTag(tag, path string) string {
+	if !strings.Contains(tag, "*") {
+		return tag
+	}
+	pathTag := strings.ReplaceAll(strings.TrimPrefix(filepath.ToSlash(path), "/"), "/", ".")
+	return strings.ReplaceAll(tag, "*", pathTag)
+}
+
 func (t *TailInput) loadPositions() {
 	if _, err := os.Stat(t.posFile); err == nil {
 		data, err := os.ReadFile(t.posFile)
@@ -123,7 +148,7 @@ func (t *TailInput) readNewContent() {
 			event := NewEvent(t.tag, map[string]interface{}{
 				"message": line,
 			})
-			t.outputQueue.Put(event)
+			t.outputQueue.Put(t.inject(event, t.path, ""))
 		}
 	}
 
@@ -199,6 +224,7 @@ func (t *TcpInput) handleClient(conn net.Conn) {
 	defer conn.Close()
 	log.Printf("Accepted connection from %s", conn.RemoteAddr())
 
+	sourceIP := remoteIP(conn)
 	scanner := bufio.NewScanner(conn)
 	for scanner.Scan() && t.IsRunning() {
 		line := scanner.Text()
@@ -206,7 +232,7 @@ func (t *TcpInput) handleClient(conn net.Conn) {
 			event := NewEvent(t.tag, map[string]interface{}{
 				"message": line,
 			})
-			t.outputQueue.Put(event)
+			t.outputQueue.Put(t.inject(event, "", sourceIP))
 		}
 	}
 
@@ -0,0 +1,482 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultJournalCommand 未配置 path 和 address 时读取本机 journal 的命令
+const DefaultJournalCommand = "journalctl -o export --follow"
+
+// journalSaveInterval 读取 socket 或命令输出时保存位置文件的最小间隔
+const journalSaveInterval = time.Second
+
+// journalPosition 记录某个来源最后处理的 cursor，文件来源还会记录读取偏移
+type journalPosition struct {
+	Cursor string `json:"cursor"`
+	Offset int64  `json:"offset,omitempty"`
+}
+
+// JournaldInput 读取 systemd Journal Export Format 的输入插件，
+// 来源可以是导出文件 (path)、监听的 socket (address) 或命令的标准输出 (command)
+type JournaldInput struct {
+	*BaseInput
+	path      string
+	address   string
+	command   string
+	posFile   string
+	positions map[string]journalPosition
+	posMu     sync.Mutex
+	observer  *FileObserver
+	listener  net.Listener
+	cancel    context.CancelFunc
+	// conns 正在读取的 socket 连接，停止时关闭
+	connsMu sync.Mutex
+	conns   map[net.Conn]struct{}
+}
+
+// NewJournaldInput 创建一个新的 journald 输入插件
+func NewJournaldInput(tag string, outputQueue *Queue, path, address, command, posFile string) *JournaldInput {
+	if path == "" && address == "" && command == "" {
+		command = DefaultJournalCommand
+	}
+
+	input := &JournaldInput{
+		BaseInput: NewBaseInput(tag, outputQueue),
+		path:      path,
+		address:   address,
+		command:   command,
+		posFile:   posFile,
+		positions: make(map[string]journalPosition),
+		conns:     make(map[net.Conn]struct{}),
+	}
+
+	input.loadPositions()
+
+	if path != "" {
+		input.observer = NewFileObserver(filepath.Dir(path), func(event FileEvent) {
+			if event.Path == path && event.Type == FileEventModify {
+				input.readFile()
+			}
+		})
+	}
+
+	return input
+}
+
+// source 返回用于记录位置的来源名称
+func (j *JournaldInput) source() string {
+	switch {
+	case j.path != "":
+		return j.path
+	case j.address != "":
+		return j.address
+	default:
+		return j.command
+	}
+}
+
+func (j *JournaldInput) loadPositions() {
+	data, err := os.ReadFile(j.posFile)
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(data, &j.positions); err != nil {
+		log.Printf("Error loading journal positions from %s: %v", j.posFile, err)
+	}
+}
+
+func (j *JournaldInput) savePositions() {
+	j.posMu.Lock()
+	data, err := json.Marshal(j.positions)
+	j.posMu.Unlock()
+	if err != nil {
+		log.Printf("Error saving journal positions: %v", err)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(j.posFile), 0755); err != nil {
+		log.Printf("Error creating pos file directory: %v", err)
+		return
+	}
+
+	if err := os.WriteFile(j.posFile, data, 0644); err != nil {
+		log.Printf("Error writing pos file: %v", err)
+	}
+}
+
+func (j *JournaldInput) position() journalPosition {
+	j.posMu.Lock()
+	defer j.posMu.Unlock()
+	return j.positions[j.source()]
+}
+
+func (j *JournaldInput) setPosition(pos journalPosition) {
+	j.posMu.Lock()
+	j.positions[j.source()] = pos
+	j.posMu.Unlock()
+}
+
+// emit 将一条 journal 记录转换为事件，返回该记录的 cursor。sourceIP 为发送记录的客户端，没有时为空
+func (j *JournaldInput) emit(fields map[string]string, sourceIP string) string {
+	event := NewEvent(j.tag, journalRecord(fields))
+	if realtime, err := strconv.ParseInt(fields["__REALTIME_TIMESTAMP"], 10, 64); err == nil {
+		event.Timestamp = time.UnixMicro(realtime)
+	}
+	j.outputQueue.Put(j.inject(event, j.path, sourceIP))
+	return fields["__CURSOR"]
+}
+
+// readFile 从上次的偏移处读取导出文件中新增的完整记录
+func (j *JournaldInput) readFile() {
+	file, err := os.Open(j.path)
+	if err != nil {
+		log.Printf("Error opening file %s: %v", j.path, err)
+		return
+	}
+	defer file.Close()
+
+	pos := j.position()
+	if info, err := file.Stat(); err == nil && info.Size() < pos.Offset {
+		// 文件被截断或替换，从头开始读取
+		pos.Offset = 0
+	}
+	if _, err := file.Seek(pos.Offset, io.SeekStart); err != nil {
+		log.Printf("Error seeking file %s: %v", j.path, err)
+		return
+	}
+
+	reader := NewJournalExportReader(file)
+	start := pos
+	for {
+		fields, err := reader.Next()
+		if err != nil {
+			// 末尾不完整的记录留到下次读取
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				log.Printf("Error reading journal file %s: %v", j.path, err)
+			}
+			break
+		}
+		if cursor := j.emit(fields, ""); cursor != "" {
+			pos.Cursor = cursor
+		}
+		pos.Offset = start.Offset + reader.Offset()
+	}
+
+	if pos != start {
+		j.setPosition(pos)
+		j.savePositions()
+	}
+}
+
+// readStream 读取一个导出流直到结束，每条记录处理后更新 cursor，
+// 位置文件每隔 journalSaveInterval 以及流结束时保存一次
+func (j *JournaldInput) readStream(r io.Reader, sourceIP string) error {
+	reader := NewJournalExportReader(r)
+	dirty := false
+	lastSave := time.Now()
+	defer func() {
+		if dirty {
+			j.savePositions()
+		}
+	}()
+
+	for j.IsRunning() {
+		fields, err := reader.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if cursor := j.emit(fields, sourceIP); cursor != "" {
+			j.setPosition(journalPosition{Cursor: cursor})
+			dirty = true
+		}
+		if dirty && time.Since(lastSave) >= journalSaveInterval {
+			j.savePositions()
+			dirty = false
+			lastSave = time.Now()
+		}
+	}
+	return nil
+}
+
+// journalctlCommand 判断命令是否调用 journalctl，只有 journalctl 支持 --after-cursor
+func journalctlCommand(command string) bool {
+	for _, field := range strings.Fields(command) {
+		if filepath.Base(field) == "journalctl" {
+			return true
+		}
+	}
+	return false
+}
+
+// shellQuote 用单引号包裹字符串，使其在 sh -c 中作为一个参数且不做任何展开
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// runCommand 运行命令并读取其输出，退出后等待一段时间重新启动。命令调用 journalctl 时
+// 加上 --after-cursor 从保存的 cursor 处继续
+func (j *JournaldInput) runCommand(ctx context.Context) {
+	for j.IsRunning() {
+		command := j.command
+		if cursor := j.position().Cursor; cursor != "" && journalctlCommand(command) {
+			command += " --after-cursor=" + shellQuote(cursor)
+		}
+
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		setProcessGroup(cmd)
+		cmd.Stderr = os.Stderr
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			log.Printf("Error creating pipe for %q: %v", command, err)
+			return
+		}
+		if err := cmd.Start(); err != nil {
+			log.Printf("Error starting %q: %v", command, err)
+		} else {
+			if err := j.readStream(stdout, ""); err != nil {
+				log.Printf("Error reading journal from %q: %v", command, err)
+			}
+			cmd.Wait()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// trackConn 登记新的连接，已经停止时返回 false
+func (j *JournaldInput) trackConn(conn net.Conn) bool {
+	j.connsMu.Lock()
+	defer j.connsMu.Unlock()
+	if !j.IsRunning() {
+		return false
+	}
+	j.conns[conn] = struct{}{}
+	return true
+}
+
+func (j *JournaldInput) untrackConn(conn net.Conn) {
+	j.connsMu.Lock()
+	defer j.connsMu.Unlock()
+	delete(j.conns, conn)
+}
+
+// closeConns 关闭所有连接，阻塞在读取上的 handleConn 随之返回
+func (j *JournaldInput) closeConns() {
+	j.connsMu.Lock()
+	defer j.connsMu.Unlock()
+	for conn := range j.conns {
+		conn.Close()
+	}
+}
+
+func (j *JournaldInput) handleConn(conn net.Conn) {
+	defer j.BaseInput.wg.Done()
+	defer j.untrackConn(conn)
+	defer conn.Close()
+	if err := j.readStream(conn, remoteIP(conn)); err != nil && j.IsRunning() {
+		log.Printf("Error reading journal from %s: %v", conn.RemoteAddr(), err)
+	}
+}
+
+func (j *JournaldInput) Start() {
+	if j.IsRunning() {
+		return
+	}
+
+	if j.address != "" {
+		network, address := splitNetworkAddress(j.address)
+		listener, err := net.Listen(network, address)
+		if err != nil {
+			log.Printf("Error starting journal listener: %v", err)
+			return
+		}
+		j.listener = listener
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j.cancel = cancel
+
+	j.SetRunning(true)
+	j.BaseInput.wg.Add(1)
+
+	go func() {
+		defer j.BaseInput.wg.Done()
+		log.Printf("Starting JournaldInput for %s with tag %s", j.source(), j.tag)
+
+		switch {
+		case j.path != "":
+			j.readFile()
+			j.observer.Start()
+			for j.IsRunning() {
+				time.Sleep(1 * time.Second)
+			}
+			j.observer.Stop()
+		case j.listener != nil:
+			for j.IsRunning() {
+				conn, err := j.listener.Accept()
+				if err != nil {
+					if !j.IsRunning() {
+						break
+					}
+					log.Printf("Error accepting connection: %v", err)
+					continue
+				}
+				if !j.trackConn(conn) {
+					conn.Close()
+					break
+				}
+				j.BaseInput.wg.Add(1)
+				go j.handleConn(conn)
+			}
+		default:
+			j.runCommand(ctx)
+		}
+	}()
+}
+
+func (j *JournaldInput) Stop() {
+	if !j.IsRunning() {
+		return
+	}
+
+	j.SetRunning(false)
+	j.cancel()
+	if j.listener != nil {
+		j.listener.Close()
+	}
+	j.closeConns()
+	j.BaseInput.wg.Wait()
+	log.Printf("Stopped JournaldInput for %s", j.source())
+}
+
+// journalRecord 将 journal 字段转换为记录：字段名转为小写并去掉前导下划线，
+// 例如 _SYSTEMD_UNIT 变为 systemd_unit，MESSAGE 变为 message；
+// 以双下划线开头的地址字段 (__CURSOR 等) 不写入记录
+func journalRecord(fields map[string]string) map[string]interface{} {
+	record := make(map[string]interface{}, len(fields))
+	for name, value := range fields {
+		if strings.HasPrefix(name, "__") {
+			continue
+		}
+		key := strings.ToLower(strings.TrimLeft(name, "_"))
+		if name == "PRIORITY" {
+			if priority, err := strconv.Atoi(value); err == nil {
+				record[key] = priority
+				continue
+			}
+		}
+		record[key] = value
+	}
+	return record
+}
+
+// splitNetworkAddress 解析 unix:///path 或 tcp://host:port 形式的地址，默认为 tcp
+func splitNetworkAddress(address string) (string, string) {
+	if i := strings.Index(address, "://"); i > 0 {
+		return address[:i], address[i+3:]
+	}
+	return "tcp", address
+}
+
+// JournalExportReader 解析 systemd Journal Export Format，
+// 参见 https://systemd.io/JOURNAL_EXPORT_FORMATS/
+type JournalExportReader struct {
+	reader *bufio.Reader
+	offset int64
+}
+
+// NewJournalExportReader 创建一个新的导出格式读取器
+func NewJournalExportReader(r io.Reader) *JournalExportReader {
+	return &JournalExportReader{reader: bufio.NewReader(r)}
+}
+
+// Offset 返回最后一条完整记录之后的字节偏移
+func (r *JournalExportReader) Offset() int64 {
+	return r.offset
+}
+
+// Next 读取下一条记录。记录之间以空行分隔，普通字段为 KEY=value，
+// 二进制字段为 KEY 换行后跟 64 位小端长度和数据。
+// 流在记录中间结束时返回 io.ErrUnexpectedEOF
+func (r *JournalExportReader) Next() (map[string]string, error) {
+	fields := make(map[string]string)
+	var consumed int64
+
+	for {
+		line, err := r.reader.ReadString('\n')
+		consumed += int64(len(line))
+		if err != nil {
+			if err == io.EOF && len(fields) == 0 && line == "" {
+				return nil, io.EOF
+			}
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if len(fields) == 0 {
+				// 跳过多余的空行
+				r.offset += consumed
+				consumed = 0
+				continue
+			}
+			r.offset += consumed
+			return fields, nil
+		}
+
+		if i := strings.IndexByte(line, '='); i >= 0 {
+			fields[line[:i]] = line[i+1:]
+			continue
+		}
+
+		// 二进制字段
+		var size uint64
+		if err := binary.Read(r.reader, binary.LittleEndian, &size); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if size > 64*1024*1024 {
+			return nil, fmt.Errorf("journal field %s too large: %d bytes", line, size)
+		}
+		data := make([]byte, size+1)
+		if _, err := io.ReadFull(r.reader, data); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if data[size] != '\n' {
+			return nil, errors.New("journal binary field " + line + " not terminated by newline")
+		}
+		consumed += 8 + int64(size) + 1
+		fields[line] = string(data[:size])
+	}
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
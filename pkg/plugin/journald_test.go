@@ -0,0 +1,55 @@
+package plugin
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJournaldInputStopClosesConnections(t *testing.T) {
+	posFile := filepath.Join(t.TempDir(), "journal.pos")
+	out := NewQueue(10)
+	j := NewJournaldInput("journal", out, "", "tcp://127.0.0.1:0", "", posFile)
+	j.Start()
+	if j.listener == nil {
+		t.Fatal("listener not started")
+	}
+
+	conn, err := net.Dial("tcp", j.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, "MESSAGE=hello\n__CURSOR=c1\n\n"); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for out.Len() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the journal record")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 客户端保持连接，Stop 关闭连接并等待读取结束
+	j.Stop()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) && !strings.Contains(err.Error(), "reset") {
+		t.Errorf("Read after Stop: %v, want the connection closed", err)
+	}
+	// 连接的读取在 Stop 返回前结束，位置已经保存
+	data, err := os.ReadFile(posFile)
+	if err != nil || !strings.Contains(string(data), `"c1"`) {
+		t.Errorf("positions = %s, %v, want cursor c1 saved", data, err)
+	}
+	j.connsMu.Lock()
+	defer j.connsMu.Unlock()
+	if n := len(j.conns); n != 0 {
+		t.Errorf("%d connections still tracked after Stop", n)
+	}
+}
@@ -0,0 +1,558 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	kubernetesTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	kubernetesCAFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+
+	// DefaultKubernetesTagPattern 从容器日志文件名中解析 pod、namespace 和容器名，
+	// 对应 /var/log/containers/<pod>_<namespace>_<container>-<docker_id>.log，
+	// 文件输入的 tag 配置为 kubernetes.* 时标签中包含这个路径。标签不匹配时从记录的 namespace_key 和 pod_key 中读取
+	DefaultKubernetesTagPattern = `var\.log\.containers\.(?P<pod_name>[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*)_(?P<namespace>[^_]+)_(?P<container_name>.+)-(?P<docker_id>[a-z0-9]{64})\.log$`
+)
+
+// kubernetesErrorTTL API Server 返回错误时缓存错误的时间，期间同一个对象不再发请求
+const kubernetesErrorTTL = 10 * time.Second
+
+var errKubernetesNotFound = errors.New("kubernetes object not found")
+
+// KubernetesMetadataOptions kubernetes_metadata 过滤插件的配置
+type KubernetesMetadataOptions struct {
+	// APIServer 为空时使用集群内的 KUBERNETES_SERVICE_HOST/KUBERNETES_SERVICE_PORT
+	APIServer          string
+	BearerTokenFile    string
+	CAFile             string
+	InsecureSkipVerify bool
+	CacheTTL           time.Duration
+	Watch              bool
+	// NodeName 不为空时只监听这个节点上的 pod (fieldSelector=spec.nodeName=<node>)，
+	// 默认为环境变量 K8S_NODE_NAME，通常通过 downward API 设置为 spec.nodeName
+	NodeName     string
+	TagPattern   string
+	NamespaceKey string
+	PodKey       string
+}
+
+// KubernetesMetadataFilter 为容器日志添加 pod 和 namespace 的元数据
+type KubernetesMetadataFilter struct {
+	*BaseFilter
+	client       *kubernetesClient
+	cache        *kubernetesCache
+	watch        bool
+	nodeName     string
+	errorTTL     time.Duration
+	tagPattern   *regexp.Regexp
+	namespaceKey *RecordAccessor
+	podKey       *RecordAccessor
+	cancel       context.CancelFunc
+	watchWg      sync.WaitGroup
+}
+
+// NewKubernetesMetadataFilter 创建一个新的 Kubernetes 元数据过滤插件
+func NewKubernetesMetadataFilter(inputQueue, outputQueue *Queue, matchTag string, opts KubernetesMetadataOptions) (*KubernetesMetadataFilter, error) {
+	if opts.TagPattern == "" {
+		opts.TagPattern = DefaultKubernetesTagPattern
+	}
+	if opts.CacheTTL <= 0 {
+		opts.CacheTTL = time.Hour
+	}
+	if opts.NamespaceKey == "" {
+		opts.NamespaceKey = "namespace_name"
+	}
+	if opts.PodKey == "" {
+		opts.PodKey = "pod_name"
+	}
+	if opts.NodeName == "" {
+		opts.NodeName = os.Getenv("K8S_NODE_NAME")
+	}
+	errorTTL := kubernetesErrorTTL
+	if errorTTL > opts.CacheTTL {
+		errorTTL = opts.CacheTTL
+	}
+
+	tagPattern, err := regexp.Compile(opts.TagPattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tag pattern: %v", err)
+	}
+	namespaceKey, err := NewRecordAccessor(opts.NamespaceKey)
+	if err != nil {
+		return nil, err
+	}
+	podKey, err := NewRecordAccessor(opts.PodKey)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newKubernetesClient(opts.APIServer, opts.BearerTokenFile, opts.CAFile, opts.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KubernetesMetadataFilter{
+		BaseFilter:   NewBaseFilter(inputQueue, outputQueue, matchTag),
+		client:       client,
+		cache:        newKubernetesCache(opts.CacheTTL),
+		watch:        opts.Watch,
+		nodeName:     opts.NodeName,
+		errorTTL:     errorTTL,
+		tagPattern:   tagPattern,
+		namespaceKey: namespaceKey,
+		podKey:       podKey,
+	}, nil
+}
+
+// Filter 查询 pod 和 namespace 元数据并写入 kubernetes 字段，查询失败时原样传递
+func (k *KubernetesMetadataFilter) Filter(event *Event) *Event {
+	namespace, podName, containerName := k.lookupKeys(event)
+	if namespace == "" || podName == "" {
+		return event
+	}
+
+	pod, err := k.getPod(namespace, podName)
+	if err != nil {
+		return event
+	}
+
+	metadata, _ := event.Record["kubernetes"].(map[string]interface{})
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	metadata["namespace_name"] = namespace
+	metadata["pod_name"] = podName
+	metadata["pod_id"] = pod.Metadata.UID
+	metadata["host"] = pod.Spec.NodeName
+	if pod.Status.PodIP != "" {
+		metadata["pod_ip"] = pod.Status.PodIP
+	}
+	if containerName != "" {
+		metadata["container_name"] = containerName
+	}
+	if len(pod.Metadata.Labels) > 0 {
+		metadata["labels"] = stringMapToRecord(pod.Metadata.Labels)
+	}
+	if len(pod.Metadata.Annotations) > 0 {
+		metadata["annotations"] = stringMapToRecord(pod.Metadata.Annotations)
+	}
+	if len(pod.Metadata.OwnerReferences) > 0 {
+		owners := make([]interface{}, 0, len(pod.Metadata.OwnerReferences))
+		for _, owner := range pod.Metadata.OwnerReferences {
+			owners = append(owners, map[string]interface{}{
+				"kind": owner.Kind,
+				"name": owner.Name,
+				"uid":  owner.UID,
+			})
+		}
+		metadata["owner_references"] = owners
+	}
+
+	if ns, err := k.getNamespace(namespace); err == nil {
+		metadata["namespace_id"] = ns.Metadata.UID
+		if len(ns.Metadata.Labels) > 0 {
+			metadata["namespace_labels"] = stringMapToRecord(ns.Metadata.Labels)
+		}
+	}
+
+	event.Record["kubernetes"] = metadata
+	return event
+}
+
+// lookupKeys 优先从标签中解析 namespace/pod，其次从记录的 kubernetes 字段或顶层字段中读取
+func (k *KubernetesMetadataFilter) lookupKeys(event *Event) (namespace, podName, containerName string) {
+	if match := k.tagPattern.FindStringSubmatch(event.Tag); match != nil {
+		for i, name := range k.tagPattern.SubexpNames() {
+			switch name {
+			case "namespace":
+				namespace = match[i]
+			case "pod_name":
+				podName = match[i]
+			case "container_name":
+				containerName = match[i]
+			}
+		}
+		if namespace != "" && podName != "" {
+			return namespace, podName, containerName
+		}
+	}
+
+	// 顶层找不到时再到 kubernetes 字段中查找
+	records := []map[string]interface{}{event.Record}
+	if nested, ok := event.Record["kubernetes"].(map[string]interface{}); ok {
+		records = append(records, nested)
+	}
+	for _, record := range records {
+		ns, _ := k.namespaceKey.Get(record)
+		pod, _ := k.podKey.Get(record)
+		namespace, _ = ns.(string)
+		podName, _ = pod.(string)
+		if namespace != "" && podName != "" {
+			containerName, _ = record["container_name"].(string)
+			return namespace, podName, containerName
+		}
+	}
+	return "", "", ""
+}
+
+func (k *KubernetesMetadataFilter) getPod(namespace, name string) (*kubernetesPod, error) {
+	return fetchKubernetesObject[kubernetesPod](k, "pod/"+namespace+"/"+name, "/api/v1/namespaces/"+namespace+"/pods/"+name)
+}
+
+func (k *KubernetesMetadataFilter) getNamespace(name string) (*kubernetesNamespace, error) {
+	return fetchKubernetesObject[kubernetesNamespace](k, "namespace/"+name, "/api/v1/namespaces/"+name)
+}
+
+// fetchKubernetesObject 先查缓存，没有时从 API Server 读取。对象不存在时按 cache_ttl 缓存，
+// 其他错误记录日志后按 errorTTL 缓存，API Server 不可用时不会为每条日志都发一次请求
+func fetchKubernetesObject[T any](k *KubernetesMetadataFilter, key, path string) (*T, error) {
+	if value, ok := k.cache.get(key); ok {
+		switch v := value.(type) {
+		case nil:
+			return nil, errKubernetesNotFound
+		case error:
+			return nil, v
+		}
+		return value.(*T), nil
+	}
+
+	object := new(T)
+	err := k.client.get(context.Background(), path, object)
+	if err == errKubernetesNotFound {
+		k.cache.set(key, nil)
+		return nil, err
+	}
+	if err != nil {
+		log.Printf("Error fetching %s: %v, retrying in %v", key, err, k.errorTTL)
+		k.cache.setTTL(key, err, k.errorTTL)
+		return nil, err
+	}
+	k.cache.set(key, object)
+	return object, nil
+}
+
+// watchPods 监听 pod 变化，更新或删除已缓存的条目，设置了节点时只监听这个节点上的 pod
+func (k *KubernetesMetadataFilter) watchPods(ctx context.Context) {
+	k.watchLoop(ctx, k.podWatchPath(), func(eventType string, object json.RawMessage) {
+		var pod kubernetesPod
+		if err := json.Unmarshal(object, &pod); err != nil {
+			return
+		}
+		key := "pod/" + pod.Metadata.Namespace + "/" + pod.Metadata.Name
+		k.updateCache(key, eventType, &pod)
+	})
+}
+
+func (k *KubernetesMetadataFilter) podWatchPath() string {
+	path := "/api/v1/pods?watch=true"
+	if k.nodeName != "" {
+		path += "&fieldSelector=" + url.QueryEscape("spec.nodeName="+k.nodeName)
+	}
+	return path
+}
+
+// watchNamespaces 监听 namespace 变化，更新或删除已缓存的条目
+func (k *KubernetesMetadataFilter) watchNamespaces(ctx context.Context) {
+	k.watchLoop(ctx, "/api/v1/namespaces?watch=true", func(eventType string, object json.RawMessage) {
+		var ns kubernetesNamespace
+		if err := json.Unmarshal(object, &ns); err != nil {
+			return
+		}
+		k.updateCache("namespace/"+ns.Metadata.Name, eventType, &ns)
+	})
+}
+
+func (k *KubernetesMetadataFilter) updateCache(key, eventType string, value interface{}) {
+	switch eventType {
+	case "DELETED":
+		k.cache.delete(key)
+	case "ADDED", "MODIFIED":
+		// 只刷新已经被查询过的对象，避免缓存整个集群
+		if _, ok := k.cache.get(key); ok {
+			k.cache.set(key, value)
+		}
+	}
+}
+
+// watchLoop 持续监听，连接断开后等待一段时间重连
+func (k *KubernetesMetadataFilter) watchLoop(ctx context.Context, path string, handle func(string, json.RawMessage)) {
+	defer k.watchWg.Done()
+
+	for {
+		err := k.client.watch(ctx, path, handle)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("Error watching %s: %v", path, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// Start 启动过滤插件
+func (k *KubernetesMetadataFilter) Start() {
+	if k.IsRunning() {
+		return
+	}
+
+	if k.watch {
+		var ctx context.Context
+		ctx, k.cancel = context.WithCancel(context.Background())
+		k.watchWg.Add(2)
+		go k.watchPods(ctx)
+		go k.watchNamespaces(ctx)
+	}
+
+	k.startLoop("KubernetesMetadataFilter", k.Filter)
+}
+
+// Stop 停止过滤插件
+func (k *KubernetesMetadataFilter) Stop() {
+	if k.cancel != nil {
+		k.cancel()
+		k.watchWg.Wait()
+		k.cancel = nil
+	}
+
+	k.stopLoop("KubernetesMetadataFilter")
+}
+
+func stringMapToRecord(m map[string]string) map[string]interface{} {
+	record := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		record[key] = value
+	}
+	return record
+}
+
+type kubernetesObjectMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace"`
+	UID             string            `json:"uid"`
+	Labels          map[string]string `json:"labels"`
+	Annotations     map[string]string `json:"annotations"`
+	OwnerReferences []struct {
+		Kind string `json:"kind"`
+		Name string `json:"name"`
+		UID  string `json:"uid"`
+	} `json:"ownerReferences"`
+}
+
+type kubernetesPod struct {
+	Metadata kubernetesObjectMeta `json:"metadata"`
+	Spec     struct {
+		NodeName string `json:"nodeName"`
+	} `json:"spec"`
+	Status struct {
+		PodIP string `json:"podIP"`
+	} `json:"status"`
+}
+
+type kubernetesNamespace struct {
+	Metadata kubernetesObjectMeta `json:"metadata"`
+}
+
+// kubernetesClient 访问 API Server 的最小 REST 客户端
+type kubernetesClient struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+	// watchClient 没有整体超时，用于长连接
+	watchClient *http.Client
+}
+
+func newKubernetesClient(apiServer, tokenFile, caFile string, insecure bool) (*kubernetesClient, error) {
+	if apiServer == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, errors.New("kubernetes API server not configured and KUBERNETES_SERVICE_HOST is not set")
+		}
+		apiServer = "https://" + net.JoinHostPort(host, port)
+		if tokenFile == "" {
+			tokenFile = kubernetesTokenFile
+		}
+		if caFile == "" {
+			caFile = kubernetesCAFile
+		}
+	}
+
+	var token string
+	if tokenFile != "" {
+		data, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("read bearer token: %v", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecure}
+	if caFile != "" {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := &http.Transport{TLSClientConfig: tlsConfig}
+
+	return &kubernetesClient{
+		baseURL:     strings.TrimRight(apiServer, "/"),
+		token:       token,
+		httpClient:  &http.Client{Transport: transport, Timeout: 10 * time.Second},
+		watchClient: &http.Client{Transport: transport},
+	}, nil
+}
+
+func (c *kubernetesClient) newRequest(ctx context.Context, path string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+func (c *kubernetesClient) get(ctx context.Context, path string, v interface{}) error {
+	req, err := c.newRequest(ctx, path)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errKubernetesNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// watch 读取 watch 流，每行一个 {"type": ..., "object": ...}
+func (c *kubernetesClient) watch(ctx context.Context, path string, handle func(string, json.RawMessage)) error {
+	req, err := c.newRequest(ctx, path)
+	if err != nil {
+		return err
+	}
+	resp, err := c.watchClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("watch %s: %s", path, resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var event struct {
+			Type   string          `json:"type"`
+			Object json.RawMessage `json:"object"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		handle(event.Type, event.Object)
+	}
+	return scanner.Err()
+}
+
+// kubernetesCache 带过期时间的内存缓存，值为 nil 表示对象不存在，值为 error 表示上次查询失败
+type kubernetesCache struct {
+	ttl       time.Duration
+	mu        sync.Mutex
+	entries   map[string]kubernetesCacheEntry
+	lastSweep time.Time
+}
+
+type kubernetesCacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+func newKubernetesCache(ttl time.Duration) *kubernetesCache {
+	return &kubernetesCache{
+		ttl:       ttl,
+		entries:   make(map[string]kubernetesCacheEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+func (c *kubernetesCache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (c *kubernetesCache) set(key string, value interface{}) {
+	c.setTTL(key, value, c.ttl)
+}
+
+// setTTL 按指定的时间缓存，用于比 ttl 更短的错误缓存
+func (c *kubernetesCache) setTTL(key string, value interface{}, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.entries[key] = kubernetesCacheEntry{value: value, expires: now.Add(ttl)}
+
+	// 定期清理过期条目，避免已删除的 pod 一直占用内存
+	if now.Sub(c.lastSweep) >= c.ttl {
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.lastSweep = now
+	}
+}
+
+func (c *kubernetesCache) delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+}
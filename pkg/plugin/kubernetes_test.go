@@ -0,0 +1,344 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testPodJSON       = `{"metadata": {"name": "web", "namespace": "default", "uid": "pod-uid", "labels": {"app": "%s"}}, "spec": {"nodeName": "node-1"}, "status": {"podIP": "10.0.0.5"}}`
+	testNamespaceJSON = `{"metadata": {"name": "default", "uid": "ns-uid", "labels": {"team": "core"}}}`
+)
+
+// fakeAPIServer 最小的 API Server，记录每个路径的请求次数，watch 请求从 events 中读取要发送的行。
+// status 不为 0 时普通请求都返回这个状态码，fieldSelector 记录 pod watch 请求的 fieldSelector
+type fakeAPIServer struct {
+	*httptest.Server
+	mu            sync.Mutex
+	requests      map[string]int
+	podLabel      string
+	status        int
+	fieldSelector string
+	events        chan string
+}
+
+func newFakeAPIServer(t *testing.T) *fakeAPIServer {
+	f := &fakeAPIServer{requests: make(map[string]int), podLabel: "v1", events: make(chan string)}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.requests[r.URL.Path]++
+		if r.URL.Path == "/api/v1/pods" {
+			f.fieldSelector = r.URL.Query().Get("fieldSelector")
+		}
+		label, status := f.podLabel, f.status
+		f.mu.Unlock()
+
+		switch {
+		case r.URL.Query().Get("watch") == "true":
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			if r.URL.Path != "/api/v1/pods" {
+				<-r.Context().Done()
+				return
+			}
+			for {
+				select {
+				case <-r.Context().Done():
+					return
+				case line := <-f.events:
+					fmt.Fprintln(w, line)
+					w.(http.Flusher).Flush()
+				}
+			}
+		case status != 0:
+			http.Error(w, http.StatusText(status), status)
+		case r.URL.Path == "/api/v1/namespaces/default/pods/web":
+			fmt.Fprintf(w, testPodJSON, label)
+		case r.URL.Path == "/api/v1/namespaces/default":
+			fmt.Fprint(w, testNamespaceJSON)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeAPIServer) count(path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[path]
+}
+
+func newTestKubernetesFilter(t *testing.T, server *fakeAPIServer, ttl time.Duration, watch bool) *KubernetesMetadataFilter {
+	t.Helper()
+	k, err := NewKubernetesMetadataFilter(NewQueue(10), NewQueue(10), "**", KubernetesMetadataOptions{
+		APIServer: server.URL,
+		CacheTTL:  ttl,
+		Watch:     watch,
+	})
+	if err != nil {
+		t.Fatalf("NewKubernetesMetadataFilter: %v", err)
+	}
+	return k
+}
+
+func TestKubernetesGetPodAndNamespace(t *testing.T) {
+	server := newFakeAPIServer(t)
+	k := newTestKubernetesFilter(t, server, time.Hour, false)
+
+	pod, err := k.getPod("default", "web")
+	if err != nil {
+		t.Fatalf("getPod: %v", err)
+	}
+	if pod.Metadata.UID != "pod-uid" || pod.Spec.NodeName != "node-1" || pod.Status.PodIP != "10.0.0.5" {
+		t.Errorf("getPod = %+v", pod)
+	}
+	ns, err := k.getNamespace("default")
+	if err != nil {
+		t.Fatalf("getNamespace: %v", err)
+	}
+	if ns.Metadata.UID != "ns-uid" || ns.Metadata.Labels["team"] != "core" {
+		t.Errorf("getNamespace = %+v", ns)
+	}
+}
+
+func TestKubernetesFilterLookup(t *testing.T) {
+	server := newFakeAPIServer(t)
+	k := newTestKubernetesFilter(t, server, time.Hour, false)
+	dockerID := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	tests := []struct {
+		name      string
+		tag       string
+		record    map[string]interface{}
+		container string
+	}{
+		{
+			name:      "tag from tail input path",
+			tag:       expandPathTag("kubernetes.*", "/var/log/containers/web_default_nginx-"+dockerID+".log"),
+			record:    map[string]interface{}{"message": "hello"},
+			container: "nginx",
+		},
+		{
+			name:   "record keys",
+			tag:    "app",
+			record: map[string]interface{}{"namespace_name": "default", "pod_name": "web"},
+		},
+		{
+			name:   "nested kubernetes keys",
+			tag:    "app",
+			record: map[string]interface{}{"kubernetes": map[string]interface{}{"namespace_name": "default", "pod_name": "web"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := k.Filter(NewEvent(tt.tag, tt.record))
+			metadata, ok := event.Record["kubernetes"].(map[string]interface{})
+			if !ok {
+				t.Fatalf("no kubernetes metadata in %v", event.Record)
+			}
+			if metadata["pod_id"] != "pod-uid" || metadata["host"] != "node-1" || metadata["namespace_id"] != "ns-uid" {
+				t.Errorf("metadata = %v", metadata)
+			}
+			if labels, _ := metadata["labels"].(map[string]interface{}); labels["app"] != "v1" {
+				t.Errorf("labels = %v", metadata["labels"])
+			}
+			if tt.container != "" && metadata["container_name"] != tt.container {
+				t.Errorf("container_name = %v, want %s", metadata["container_name"], tt.container)
+			}
+		})
+	}
+}
+
+func TestKubernetesCacheTTL(t *testing.T) {
+	server := newFakeAPIServer(t)
+	k := newTestKubernetesFilter(t, server, 50*time.Millisecond, false)
+	path := "/api/v1/namespaces/default/pods/web"
+
+	for i := 0; i < 3; i++ {
+		if _, err := k.getPod("default", "web"); err != nil {
+			t.Fatalf("getPod: %v", err)
+		}
+	}
+	if n := server.count(path); n != 1 {
+		t.Fatalf("requests before expiry = %d, want 1", n)
+	}
+
+	time.Sleep(80 * time.Millisecond)
+	if _, err := k.getPod("default", "web"); err != nil {
+		t.Fatalf("getPod: %v", err)
+	}
+	if n := server.count(path); n != 2 {
+		t.Fatalf("requests after expiry = %d, want 2", n)
+	}
+}
+
+func TestKubernetesNotFoundPassThrough(t *testing.T) {
+	server := newFakeAPIServer(t)
+	k := newTestKubernetesFilter(t, server, time.Hour, false)
+	path := "/api/v1/namespaces/default/pods/missing"
+
+	for i := 0; i < 2; i++ {
+		record := map[string]interface{}{"namespace_name": "default", "pod_name": "missing", "message": "hello"}
+		event := k.Filter(NewEvent("app", record))
+		if event == nil {
+			t.Fatal("event dropped")
+		}
+		if _, ok := event.Record["kubernetes"]; ok {
+			t.Errorf("unexpected metadata %v", event.Record["kubernetes"])
+		}
+		if event.Record["message"] != "hello" {
+			t.Errorf("record changed: %v", event.Record)
+		}
+	}
+	// 不存在的结果也被缓存
+	if n := server.count(path); n != 1 {
+		t.Errorf("requests = %d, want 1", n)
+	}
+}
+
+func TestKubernetesErrorCache(t *testing.T) {
+	server := newFakeAPIServer(t)
+	server.status = http.StatusServiceUnavailable
+	k := newTestKubernetesFilter(t, server, time.Hour, false)
+	k.errorTTL = 50 * time.Millisecond
+	path := "/api/v1/namespaces/default/pods/web"
+
+	for i := 0; i < 3; i++ {
+		record := map[string]interface{}{"namespace_name": "default", "pod_name": "web"}
+		if event := k.Filter(NewEvent("app", record)); event == nil || event.Record["kubernetes"] != nil {
+			t.Fatalf("Filter = %v, want the event unchanged", event)
+		}
+	}
+	// 错误在 errorTTL 内被缓存，不会每条日志都请求 API Server
+	if n := server.count(path); n != 1 {
+		t.Fatalf("requests while failing = %d, want 1", n)
+	}
+
+	server.mu.Lock()
+	server.status = 0
+	server.mu.Unlock()
+	time.Sleep(80 * time.Millisecond)
+	if _, err := k.getPod("default", "web"); err != nil {
+		t.Fatalf("getPod after recovery: %v", err)
+	}
+	if n := server.count(path); n != 2 {
+		t.Errorf("requests after recovery = %d, want 2", n)
+	}
+}
+
+func TestKubernetesErrorTTL(t *testing.T) {
+	server := newFakeAPIServer(t)
+	if k := newTestKubernetesFilter(t, server, time.Hour, false); k.errorTTL != kubernetesErrorTTL {
+		t.Errorf("errorTTL = %v, want %v", k.errorTTL, kubernetesErrorTTL)
+	}
+	// 错误的缓存时间不超过 cache_ttl
+	if k := newTestKubernetesFilter(t, server, time.Second, false); k.errorTTL != time.Second {
+		t.Errorf("errorTTL = %v, want the cache ttl", k.errorTTL)
+	}
+}
+
+func TestKubernetesWatchNodeName(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      string
+		nodeName string
+		want     string
+	}{
+		{name: "all pods"},
+		{name: "option", nodeName: "node-1", want: "spec.nodeName=node-1"},
+		{name: "environment", env: "node-2", want: "spec.nodeName=node-2"},
+		{name: "option overrides environment", env: "node-2", nodeName: "node-1", want: "spec.nodeName=node-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("K8S_NODE_NAME", tt.env)
+			server := newFakeAPIServer(t)
+			k, err := NewKubernetesMetadataFilter(NewQueue(10), NewQueue(10), "**", KubernetesMetadataOptions{
+				APIServer: server.URL,
+				Watch:     true,
+				NodeName:  tt.nodeName,
+			})
+			if err != nil {
+				t.Fatalf("NewKubernetesMetadataFilter: %v", err)
+			}
+			k.Start()
+			defer k.Stop()
+
+			deadline := time.Now().Add(2 * time.Second)
+			for server.count("/api/v1/pods") == 0 {
+				if time.Now().After(deadline) {
+					t.Fatal("timed out waiting for the pod watch")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			server.mu.Lock()
+			defer server.mu.Unlock()
+			if server.fieldSelector != tt.want {
+				t.Errorf("fieldSelector = %q, want %q", server.fieldSelector, tt.want)
+			}
+		})
+	}
+}
+
+func TestKubernetesWatchUpdates(t *testing.T) {
+	server := newFakeAPIServer(t)
+	k := newTestKubernetesFilter(t, server, time.Hour, true)
+	k.Start()
+	defer k.Stop()
+
+	if _, err := k.getPod("default", "web"); err != nil {
+		t.Fatalf("getPod: %v", err)
+	}
+
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	server.events <- `{"type": "MODIFIED", "object": ` + fmt.Sprintf(testPodJSON, "v2") + `}`
+	waitFor("modified pod", func() bool {
+		value, ok := k.cache.get("pod/default/web")
+		return ok && value.(*kubernetesPod).Metadata.Labels["app"] == "v2"
+	})
+
+	server.events <- `{"type": "DELETED", "object": ` + fmt.Sprintf(testPodJSON, "v2") + `}`
+	waitFor("deleted pod", func() bool {
+		_, ok := k.cache.get("pod/default/web")
+		return !ok
+	})
+
+	// 未查询过的 pod 不会被 watch 加入缓存
+	server.events <- `{"type": "ADDED", "object": {"metadata": {"name": "other", "namespace": "default"}}}`
+	server.events <- `{"type": "MODIFIED", "object": ` + fmt.Sprintf(testPodJSON, "v3") + `}`
+	time.Sleep(50 * time.Millisecond)
+	if _, ok := k.cache.get("pod/default/other"); ok {
+		t.Error("watch added an uncached pod")
+	}
+}
+
+func TestExpandPathTag(t *testing.T) {
+	tests := []struct {
+		tag, path, want string
+	}{
+		{"app", "/var/log/app.log", "app"},
+		{"kubernetes.*", "/var/log/containers/a_b_c.log", "kubernetes.var.log.containers.a_b_c.log"},
+		{"*", "logs/app.log", "logs.app.log"},
+	}
+	for _, tt := range tests {
+		if got := expandPathTag(tt.tag, tt.path); got != tt.want {
+			t.Errorf("expandPathTag(%q, %q) = %q, want %q", tt.tag, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package plugin
+
+import "container/list"
+
+// lruCache 容量有限的 LRU 缓存，超过容量时淘汰最久未使用的条目。不是并发安全的，调用方负责加锁
+type lruCache[K comparable, V any] struct {
+	capacity int
+	items    map[K]*list.Element
+	order    *list.List
+}
+
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// newLRUCache 创建一个 LRU 缓存，capacity 小于等于 0 时不限容量
+func newLRUCache[K comparable, V any](capacity int) *lruCache[K, V] {
+	return &lruCache[K, V]{
+		capacity: capacity,
+		items:    make(map[K]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get 读取条目并将其标记为最近使用
+func (c *lruCache[K, V]) Get(key K) (V, bool) {
+	if elem, ok := c.items[key]; ok {
+		c.order.MoveToFront(elem)
+		return elem.Value.(*lruEntry[K, V]).value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Add 写入条目，超过容量时淘汰并返回最久未使用的条目
+func (c *lruCache[K, V]) Add(key K, value V) (evictedKey K, evicted V, ok bool) {
+	if elem, exists := c.items[key]; exists {
+		c.order.MoveToFront(elem)
+		elem.Value.(*lruEntry[K, V]).value = value
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruEntry[K, V]{key: key, value: value})
+	if c.capacity > 0 && c.order.Len() > c.capacity {
+		return c.RemoveOldest()
+	}
+	return
+}
+
+// Remove 删除条目
+func (c *lruCache[K, V]) Remove(key K) {
+	if elem, ok := c.items[key]; ok {
+		c.order.Remove(elem)
+		delete(c.items, key)
+	}
+}
+
+// RemoveOldest 删除并返回最久未使用的条目
+func (c *lruCache[K, V]) RemoveOldest() (key K, value V, ok bool) {
+	elem := c.order.Back()
+	if elem == nil {
+		return
+	}
+	entry := elem.Value.(*lruEntry[K, V])
+	c.order.Remove(elem)
+	delete(c.items, entry.key)
+	return entry.key, entry.value, true
+}
+
+// Oldest 返回最久未使用的条目，不改变顺序
+func (c *lruCache[K, V]) Oldest() (key K, value V, ok bool) {
+	elem := c.order.Back()
+	if elem == nil {
+		return
+	}
+	entry := elem.Value.(*lruEntry[K, V])
+	return entry.key, entry.value, true
+}
+
+// Each 从最近使用到最久未使用依次遍历条目，fn 返回 false 时停止
+func (c *lruCache[K, V]) Each(fn func(key K, value V) bool) {
+	for elem := c.order.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*lruEntry[K, V])
+		if !fn(entry.key, entry.value) {
+			return
+		}
+	}
+}
+
+// Len 返回条目数
+func (c *lruCache[K, V]) Len() int {
+	return c.order.Len()
+}
@@ -0,0 +1,349 @@
+package plugin
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultMask mask 方式使用的默认替换文本
+const DefaultMask = "****"
+
+// MaskDetectors 内置的检测器：email、credit_card (通过 Luhn 校验)、ipv4、ipv6，ip 表示 ipv4 和 ipv6
+var MaskDetectors = []string{"email", "credit_card", "ipv4", "ipv6"}
+
+// MaskPattern 用户自定义的检测器
+type MaskPattern struct {
+	Name    string
+	Pattern string
+}
+
+// MaskOptions mask 过滤插件的配置
+type MaskOptions struct {
+	// Keys 要检查的字段，支持 record accessor 语法，字段是 map 或数组时检查其中所有字符串和数字；
+	// 为空时检查整条记录。数字按十进制文本检查，被替换后变为字符串
+	Keys []string
+	// Detectors 使用的内置检测器，Detectors 和 Patterns 都为空时使用所有内置检测器
+	Detectors []string
+	Patterns  []MaskPattern
+	// Method 替换方式：mask (默认) 替换为 Mask，hash 替换为以 HMACKey 为密钥的 HMAC-SHA256，
+	// 相同的值得到相同的结果，可以用于关联；partial 保留格式和部分字符，例如 ****-****-****-1111
+	Method  string
+	Mask    string
+	HMACKey string
+}
+
+type maskDetector struct {
+	name    string
+	pattern *regexp.Regexp
+	// find 查找所有匹配的位置，为 nil 时使用 pattern
+	find func(string) [][]int
+	// valid 进一步校验匹配到的文本，为 nil 时不校验
+	valid   func(string) bool
+	partial func(string) string
+	count   int64
+}
+
+// MaskFilter 检测并替换记录中的敏感信息
+type MaskFilter struct {
+	*BaseFilter
+	keys      []*RecordAccessor
+	detectors []*maskDetector
+	replace   func(d *maskDetector, s string) string
+}
+
+var (
+	emailPattern      = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+	creditCardPattern = regexp.MustCompile(`\b\d(?:[ -]?\d)*\b`)
+	ipv4Pattern       = regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\.){3}(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\b`)
+	ipv6Pattern       = regexp.MustCompile(`(?:[0-9A-Fa-f]{1,4}|:)(?::[0-9A-Fa-f]{0,4}){2,7}(?:%[0-9A-Za-z]+)?`)
+)
+
+func newBuiltinDetector(name string) (*maskDetector, error) {
+	switch name {
+	case "email":
+		return &maskDetector{name: name, pattern: emailPattern, partial: partialEmail}, nil
+	case "credit_card":
+		return &maskDetector{name: name, pattern: creditCardPattern, find: findCreditCards, partial: partialKeepLast}, nil
+	case "ipv4":
+		return &maskDetector{name: name, pattern: ipv4Pattern, partial: partialIPv4}, nil
+	case "ipv6":
+		return &maskDetector{name: name, pattern: ipv6Pattern, valid: func(s string) bool {
+			if i := strings.IndexByte(s, '%'); i >= 0 {
+				s = s[:i]
+			}
+			return strings.Count(s, ":") >= 2 && net.ParseIP(s) != nil
+		}, partial: partialKeepLast}, nil
+	}
+	return nil, fmt.Errorf("unknown mask detector %q", name)
+}
+
+// NewMaskFilter 创建一个新的敏感信息过滤插件
+func NewMaskFilter(inputQueue, outputQueue *Queue, matchTag string, opts MaskOptions) (*MaskFilter, error) {
+	m := &MaskFilter{
+		BaseFilter: NewBaseFilter(inputQueue, outputQueue, matchTag),
+	}
+
+	var detectors []string
+	for _, name := range opts.Detectors {
+		if name == "ip" {
+			detectors = append(detectors, "ipv4", "ipv6")
+		} else {
+			detectors = append(detectors, name)
+		}
+	}
+	if len(detectors) == 0 && len(opts.Patterns) == 0 {
+		detectors = MaskDetectors
+	}
+	for _, name := range detectors {
+		d, err := newBuiltinDetector(name)
+		if err != nil {
+			return nil, err
+		}
+		m.detectors = append(m.detectors, d)
+	}
+	for _, p := range opts.Patterns {
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mask pattern %s: %v", p.Name, err)
+		}
+		name := p.Name
+		if name == "" {
+			name = p.Pattern
+		}
+		m.detectors = append(m.detectors, &maskDetector{name: name, pattern: re, partial: partialKeepLast})
+	}
+
+	switch opts.Method {
+	case "", "mask":
+		mask := opts.Mask
+		if mask == "" {
+			mask = DefaultMask
+		}
+		m.replace = func(*maskDetector, string) string { return mask }
+	case "hash":
+		if opts.HMACKey == "" {
+			return nil, fmt.Errorf("mask method hash requires an hmac_key")
+		}
+		key := []byte(opts.HMACKey)
+		m.replace = func(_ *maskDetector, s string) string {
+			mac := hmac.New(sha256.New, key)
+			mac.Write([]byte(s))
+			return hex.EncodeToString(mac.Sum(nil))
+		}
+	case "partial":
+		m.replace = func(d *maskDetector, s string) string { return d.partial(s) }
+	default:
+		return nil, fmt.Errorf("unknown mask method %q", opts.Method)
+	}
+
+	for _, key := range opts.Keys {
+		accessor, err := NewRecordAccessor(key)
+		if err != nil {
+			return nil, err
+		}
+		m.keys = append(m.keys, accessor)
+	}
+	return m, nil
+}
+
+// maskString 在原始字符串上查找所有检测器的匹配，与前面的检测器重叠的匹配被忽略，
+// 保证替换结果不会被再次匹配
+func (m *MaskFilter) maskString(s string) string {
+	type span struct {
+		start, end int
+		detector   *maskDetector
+	}
+	var spans []span
+	for _, d := range m.detectors {
+		var locs [][]int
+		if d.find != nil {
+			locs = d.find(s)
+		} else {
+			locs = d.pattern.FindAllStringIndex(s, -1)
+		}
+		for _, loc := range locs {
+			if d.valid != nil && !d.valid(s[loc[0]:loc[1]]) {
+				continue
+			}
+			overlaps := false
+			for _, sp := range spans {
+				if loc[0] < sp.end && sp.start < loc[1] {
+					overlaps = true
+					break
+				}
+			}
+			if !overlaps {
+				spans = append(spans, span{loc[0], loc[1], d})
+			}
+		}
+	}
+	if len(spans) == 0 {
+		return s
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	var b strings.Builder
+	last := 0
+	for _, sp := range spans {
+		atomic.AddInt64(&sp.detector.count, 1)
+		b.WriteString(s[last:sp.start])
+		b.WriteString(m.replace(sp.detector, s[sp.start:sp.end]))
+		last = sp.end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// maskValue 递归替换 map 和数组中的字符串和数字，数字只有被替换时才变为字符串
+func (m *MaskFilter) maskValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return m.maskString(v)
+	case int, int32, int64, uint64, float32, float64, json.Number:
+		s := toString(v)
+		if masked := m.maskString(s); masked != s {
+			return masked
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = m.maskValue(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = m.maskValue(item)
+		}
+	}
+	return value
+}
+
+// Filter 执行过滤操作
+func (m *MaskFilter) Filter(event *Event) *Event {
+	if len(m.keys) == 0 {
+		m.maskValue(event.Record)
+		return event
+	}
+	for _, key := range m.keys {
+		if value, ok := key.Get(event.Record); ok {
+			key.Set(event.Record, m.maskValue(value))
+		}
+	}
+	return event
+}
+
+// Counts 返回每个检测器替换的次数
+func (m *MaskFilter) Counts() map[string]int64 {
+	counts := make(map[string]int64, len(m.detectors))
+	for _, d := range m.detectors {
+		counts[d.name] += atomic.LoadInt64(&d.count)
+	}
+	return counts
+}
+
+// Start 启动过滤插件
+func (m *MaskFilter) Start() {
+	m.startLoop("MaskFilter", m.Filter)
+}
+
+// Stop 停止过滤插件
+func (m *MaskFilter) Stop() {
+	m.stopLoop("MaskFilter")
+	log.Printf("MaskFilter masked values: %v", m.Counts())
+}
+
+// findCreditCards 在每段由单个空格或 - 分隔的连续数字中查找 13 到 19 位、通过 Luhn 校验的卡号。
+// 卡号只从整段的开头或分隔符之后开始，到整段的结尾或分隔符之前结束，同一个开头优先取最长的，
+// 例如 "12345 4111 1111 1111 1111" 中只有后 16 位是卡号
+func findCreditCards(s string) [][]int {
+	var found [][]int
+	for _, run := range creditCardPattern.FindAllStringIndex(s, -1) {
+		for start := run[0]; start < run[1]; {
+			if n := longestCard(s[start:run[1]]); n > 0 {
+				found = append(found, []int{start, start + n})
+				start += n + 1
+				continue
+			}
+			next := strings.IndexAny(s[start:run[1]], " -")
+			if next < 0 {
+				break
+			}
+			start += next + 1
+		}
+	}
+	return found
+}
+
+// longestCard 返回 s 开头最长的卡号的长度，卡号在分隔符之前或 s 的结尾结束，没有时返回 0。
+// 从左向右逐位累计校验和，最多读 19 位数字，所以每个开头的开销是常数
+func longestCard(s string) int {
+	longest, n := 0, 0
+	// sums[p] 从左数下标奇偶性为 p 的数字加倍时的校验和，共 n 位时加倍的是下标奇偶性与 n 相同的数字
+	var sums [2]int
+	for i := 0; i <= len(s); i++ {
+		if i == len(s) || s[i] == ' ' || s[i] == '-' {
+			if n >= 13 && sums[n%2]%10 == 0 {
+				longest = i
+			}
+			continue
+		}
+		if n == 19 {
+			break
+		}
+		digit := int(s[i] - '0')
+		doubled := digit * 2
+		if doubled > 9 {
+			doubled -= 9
+		}
+		sums[n%2] += doubled
+		sums[1-n%2] += digit
+		n++
+	}
+	return longest
+}
+
+// partialKeepLast 保留最后 4 个字母或数字和所有分隔符，其余字母和数字替换为 *
+func partialKeepLast(s string) string {
+	b := []byte(s)
+	kept := 0
+	for i := len(b) - 1; i >= 0; i-- {
+		c := b[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			continue
+		}
+		if kept < 4 {
+			kept++
+			continue
+		}
+		b[i] = '*'
+	}
+	return string(b)
+}
+
+// partialEmail 保留用户名的第一个字符和域名，例如 j***@example.com，用户名只有一个字符时全部替换
+func partialEmail(s string) string {
+	at := strings.LastIndexByte(s, '@')
+	if at <= 0 {
+		return partialKeepLast(s)
+	}
+	if at == 1 {
+		return "*" + s[at:]
+	}
+	return s[:1] + strings.Repeat("*", at-1) + s[at:]
+}
+
+// partialIPv4 保留前两段，例如 192.168.*.*
+func partialIPv4(s string) string {
+	parts := strings.Split(s, ".")
+	for i := 2; i < len(parts); i++ {
+		parts[i] = "*"
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,100 @@
+package plugin
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindCreditCards(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want []string
+	}{
+		{"plain", "card 4111111111111111 ok", []string{"4111111111111111"}},
+		{"separated", "card 4111-1111-1111-1111", []string{"4111-1111-1111-1111"}},
+		{"digits before the card", "order 12345 4111 1111 1111 1111", []string{"4111 1111 1111 1111"}},
+		{"digits after the card", "4111 1111 1111 1111 12345", []string{"4111 1111 1111 1111"}},
+		{"two cards", "4111 1111 1111 1111 5500 0000 0000 0004", []string{"4111 1111 1111 1111", "5500 0000 0000 0004"}},
+		{"luhn failure", "4111111111111112", nil},
+		{"too short", "411111111111", nil},
+		{"inside a longer run", "94111111111111111111", nil},
+		{"inside a word", "id4111111111111111", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, loc := range findCreditCards(tt.s) {
+				got = append(got, tt.s[loc[0]:loc[1]])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findCreditCards(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindCreditCardsLongRun(t *testing.T) {
+	// 每个开头最多读 19 位数字，扫描时间随长度线性增长
+	for _, s := range []string{strings.Repeat("1 ", 32*1024), strings.Repeat("1", 64*1024)} {
+		start := time.Now()
+		if got := findCreditCards(s); got != nil {
+			t.Errorf("findCreditCards found %v in a run of ones", got)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("findCreditCards took %v for %d bytes", elapsed, len(s))
+		}
+	}
+}
+
+func TestMaskFilterNumbers(t *testing.T) {
+	tests := []struct {
+		name   string
+		keys   []string
+		record map[string]interface{}
+		want   map[string]interface{}
+	}{
+		{
+			name:   "int64 card",
+			record: map[string]interface{}{"card": int64(4111111111111111), "amount": int64(42)},
+			want:   map[string]interface{}{"card": "****", "amount": int64(42)},
+		},
+		{
+			name:   "float64 card",
+			record: map[string]interface{}{"card": float64(4111111111111111), "ratio": 1.5},
+			want:   map[string]interface{}{"card": "****", "ratio": 1.5},
+		},
+		{
+			name:   "json number in array",
+			record: map[string]interface{}{"cards": []interface{}{json.Number("4111111111111111"), json.Number("7")}},
+			want:   map[string]interface{}{"cards": []interface{}{"****", json.Number("7")}},
+		},
+		{
+			name:   "number key",
+			keys:   []string{"$.payment.card"},
+			record: map[string]interface{}{"payment": map[string]interface{}{"card": 4111111111111111}, "id": 4111111111111111},
+			want:   map[string]interface{}{"payment": map[string]interface{}{"card": "****"}, "id": 4111111111111111},
+		},
+		{
+			name:   "string card with prefix",
+			keys:   []string{"msg"},
+			record: map[string]interface{}{"msg": "order 12345 4111 1111 1111 1111"},
+			want:   map[string]interface{}{"msg": "order 12345 ****"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMaskFilter(NewQueue(1), NewQueue(1), "**", MaskOptions{Keys: tt.keys, Detectors: []string{"credit_card"}})
+			if err != nil {
+				t.Fatalf("NewMaskFilter: %v", err)
+			}
+			event := m.Filter(NewEvent("app", tt.record))
+			if !reflect.DeepEqual(event.Record, tt.want) {
+				t.Errorf("record = %#v, want %#v", event.Record, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package plugin
+
+import (
+	"path"
+	"strings"
+)
+
+// TagMatcher 标签匹配器，语义与 Fluentd 的 <match> 一致：
+// * 匹配一个标签段，** 匹配零个或多个标签段，{a,b} 匹配其中任意一个，
+// 多个模式用空格分隔，空模式匹配所有标签
+type TagMatcher struct {
+	patterns [][]string
+}
+
+// NewTagMatcher 根据模式创建标签匹配器
+func NewTagMatcher(pattern string) *TagMatcher {
+	m := &TagMatcher{}
+	for _, p := range strings.Fields(pattern) {
+		for _, expanded := range expandBraces(p) {
+			m.patterns = append(m.patterns, strings.Split(expanded, "."))
+		}
+	}
+	return m
+}
+
+// Match 检查标签是否匹配
+func (m *TagMatcher) Match(tag string) bool {
+	if len(m.patterns) == 0 {
+		return true
+	}
+	parts := strings.Split(tag, ".")
+	for _, p := range m.patterns {
+		if matchTagParts(p, parts) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchTagParts(pattern, tag []string) bool {
+	if len(pattern) == 0 {
+		return len(tag) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(tag); i++ {
+			if matchTagParts(pattern[1:], tag[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(tag) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], tag[0]); !ok {
+		return false
+	}
+	return matchTagParts(pattern[1:], tag[1:])
+}
+
+// expandBraces 展开 {a,b} 形式的模式，例如 app.{web,api} 展开为 app.web 和 app.api
+func expandBraces(pattern string) []string {
+	start := strings.IndexByte(pattern, '{')
+	if start < 0 {
+		return []string{pattern}
+	}
+	end := strings.IndexByte(pattern[start:], '}')
+	if end < 0 {
+		return []string{pattern}
+	}
+	end += start
+
+	var result []string
+	for _, alt := range strings.Split(pattern[start+1:end], ",") {
+		result = append(result, expandBraces(pattern[:start]+alt+pattern[end+1:])...)
+	}
+	return result
+}
@@ -3,6 +3,8 @@ package plugin
 import (
 	"compress/gzip"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
@@ -13,11 +15,15 @@ import (
 type OutputPlugin interface {
 	Start()
 	Stop()
+	// Failures 返回刷新失败的次数
+	Failures() int
 }
 
 type BaseOutput struct {
 	inputQueue    *Queue
 	matchTags     string
+	matcher       *TagMatcher
+	injector      *Injector
 	bufferSize    int
 	flushInterval time.Duration
 	buffer        []*Event
@@ -25,12 +31,14 @@ type BaseOutput struct {
 	mu            sync.Mutex
 	wg            sync.WaitGroup
 	lastFlush     time.Time
+	failures      int
 }
 
 func NewBaseOutput(inputQueue *Queue, matchTags string, bufferSize int, flushInterval time.Duration) *BaseOutput {
 	return &BaseOutput{
 		inputQueue:    inputQueue,
 		matchTags:     matchTags,
+		matcher:       NewTagMatcher(matchTags),
 		bufferSize:    bufferSize,
 		flushInterval: flushInterval,
 		buffer:        make([]*Event, 0, bufferSize),
@@ -51,27 +59,32 @@ func (o *BaseOutput) SetRunning(running bool) {
 	o.running = running
 }
 
+// SetInjector 设置写入元数据的 Injector，事件进入缓冲区时写入，需要在 Start 之前调用
+func (o *BaseOutput) SetInjector(injector *Injector) {
+	o.injector = injector
+}
+
 func (o *BaseOutput) Matches(tag string) bool {
-	// for _, pattern := range o.matchTags {
-	// 	// 简单的通配符匹配，*匹配任意字符
-	// 	if pattern == "*" {
-	// 		return true
-	// 	}
-	// 	if pattern[len(pattern)-1] == '*' && len(tag) >= len(pattern)-1 &&
-	// 		tag[:len(pattern)-1] == pattern[:len(pattern)-1] {
-	// 		return true
-	// 		return true
-	// 	}
-	// 	if tag == pattern {
-	// 		return true
-	// 	}
-	// }
-	// return false
-	return true
+	return o.matcher.Match(tag)
+}
+
+// drainInput 将输入队列中剩余的匹配事件放入缓冲区
+func (o *BaseOutput) drainInput() {
+	for {
+		event, ok := o.inputQueue.Get()
+		if !ok {
+			return
+		}
+		if o.Matches(event.Tag) {
+			o.AddToBuffer(event)
+		}
+	}
 }
 
 // AddToBuffer 将事件添加到缓冲区
 func (o *BaseOutput) AddToBuffer(event *Event) {
+	o.injector.Inject(event, "", "")
+
 	o.mu.Lock()
 	defer o.mu.Unlock()
 
@@ -102,6 +115,27 @@ func (o *BaseOutput) Flush(events []*Event) error {
 	return nil
 }
 
+// flushBuffer 取出缓冲区交给 flush 输出，失败时记录日志并计数
+func (o *BaseOutput) flushBuffer(flush func([]*Event) error) {
+	buffer := o.GetBuffer()
+	if len(buffer) == 0 {
+		return
+	}
+	if err := flush(buffer); err != nil {
+		log.Printf("Error flushing %d events: %v", len(buffer), err)
+		o.mu.Lock()
+		o.failures++
+		o.mu.Unlock()
+	}
+}
+
+// Failures 返回刷新失败的次数
+func (o *BaseOutput) Failures() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.failures
+}
+
 // StdoutOutput 输出到标准输出的插件
 type StdoutOutput struct {
 	*BaseOutput
@@ -117,7 +151,7 @@ func NewStdoutOutput(inputQueue *Queue, matchTags string, bufferSize int, flushI
 // Flush 刷新缓冲区，输出到标准输出
 func (s *StdoutOutput) Flush(events []*Event) error {
 	for _, event := range events {
-		log.Printf("[%s] %s: %v", event.Timestamp.Format(time.RFC3339), event.Tag, event.Record)
+		log.Printf("[%s] %s: %v", event.Timestamp.Format(time.RFC3339Nano), event.Tag, event.Record)
 	}
 	return nil
 }
@@ -142,10 +176,7 @@ func (s *StdoutOutput) Start() {
 			case <-ticker.C:
 				// 检查是否需要刷新
 				if s.ShouldFlush() {
-					buffer := s.GetBuffer()
-					if len(buffer) > 0 {
-						s.Flush(buffer)
-					}
+					s.flushBuffer(s.Flush)
 				}
 			default:
 				// 尝试获取事件
@@ -161,20 +192,15 @@ func (s *StdoutOutput) Start() {
 
 					// 检查是否需要刷新
 					if s.ShouldFlush() {
-						buffer := s.GetBuffer()
-						if len(buffer) > 0 {
-							s.Flush(buffer)
-						}
+						s.flushBuffer(s.Flush)
 					}
 				}
 			}
 		}
 
-		// 停止前最后一次刷新
-		buffer := s.GetBuffer()
-		if len(buffer) > 0 {
-			s.Flush(buffer)
-		}
+		// 停止前取出队列中剩余的事件，最后一次刷新
+		s.drainInput()
+		s.flushBuffer(s.Flush)
 	}()
 }
 
@@ -252,15 +278,17 @@ func (f *FileOutput) Flush(events []*Event) error {
 		closeFunc = file.Close
 	}
 
-	// 写入事件
+	// 写入事件，无法序列化的事件跳过，其余事件继续写入，最后一起返回错误
+	var errs []error
 	for _, event := range events {
 		data, err := json.Marshal(map[string]interface{}{
 			"tag":       event.Tag,
-			"timestamp": event.Timestamp.UnixNano() / 1e6, // 毫秒时间戳
+			"timestamp": event.Timestamp.UnixNano() / 1e6, // 毫秒时间戳，保留用于兼容
+			"time":      event.Timestamp.Format(time.RFC3339Nano),
 			"record":    event.Record,
 		})
 		if err != nil {
-			log.Printf("Error marshaling event: %v", err)
+			errs = append(errs, fmt.Errorf("marshal event with tag %s: %v", event.Tag, err))
 			continue
 		}
 
@@ -274,12 +302,15 @@ func (f *FileOutput) Flush(events []*Event) error {
 		}
 
 		if writeErr != nil {
-			log.Printf("Error writing to file: %v", writeErr)
+			// 写入失败后后面的事件也无法写入
+			errs = append(errs, fmt.Errorf("write %s: %v", f.path, writeErr))
+			break
 		}
 	}
 
 	// 关闭 writer
-	return closeFunc()
+	errs = append(errs, closeFunc())
+	return errors.Join(errs...)
 }
 
 func (f *FileOutput) Start() {
@@ -302,10 +333,7 @@ func (f *FileOutput) Start() {
 			case <-ticker.C:
 				// 检查是否需要刷新
 				if f.ShouldFlush() {
-					buffer := f.GetBuffer()
-					if len(buffer) > 0 {
-						f.Flush(buffer)
-					}
+					f.flushBuffer(f.Flush)
 				}
 			default:
 				// 尝试获取事件
@@ -321,20 +349,15 @@ func (f *FileOutput) Start() {
 
 					// 检查是否需要刷新
 					if f.ShouldFlush() {
-						buffer := f.GetBuffer()
-						if len(buffer) > 0 {
-							f.Flush(buffer)
-						}
+						f.flushBuffer(f.Flush)
 					}
 				}
 			}
 		}
 
-		// 停止前最后一次刷新
-		buffer := f.GetBuffer()
-		if len(buffer) > 0 {
-			f.Flush(buffer)
-		}
+		// 停止前取出队列中剩余的事件，最后一次刷新
+		f.drainInput()
+		f.flushBuffer(f.Flush)
 	}()
 }
 
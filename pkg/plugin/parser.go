@@ -0,0 +1,357 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parser 将一行文本解析为记录，记录中带时间字段时同时返回事件时间，否则时间为零值
+type Parser interface {
+	Parse(text string) (map[string]interface{}, time.Time, error)
+}
+
+// ParserOptions 解析器配置
+type ParserOptions struct {
+	// Format 为 none (默认)、json、regex、logfmt 或 ltsv
+	Format string
+	// Expression regex 格式使用的正则表达式，通过命名分组提取字段
+	Expression string
+	// MessageKey none 格式保存原始文本的字段名，默认为 message
+	MessageKey string
+	// TimeKey 用作事件时间的字段，解析后从记录中移除，除非 KeepTimeKey 为 true
+	TimeKey     string
+	TimeFormat  string
+	KeepTimeKey bool
+	// Timezone 时间字符串中没有时区时使用的时区，例如 Asia/Shanghai、+08:00 或 local，默认为 UTC
+	Timezone string
+	// Types 解析后按声明的类型转换字段，转换失败的字段保留原值，写法见 TypeConverter
+	Types map[string]string
+}
+
+// NewParser 根据配置创建解析器
+func NewParser(opts ParserOptions) (Parser, error) {
+	parser, err := newFormatParser(opts)
+	if err != nil || len(opts.Types) == 0 {
+		return parser, err
+	}
+	types, err := NewTypeConverter(opts.Types)
+	if err != nil {
+		return nil, err
+	}
+	return &typedParser{Parser: parser, types: types}, nil
+}
+
+func newFormatParser(opts ParserOptions) (Parser, error) {
+	base := baseParser{
+		timeFormat:  opts.TimeFormat,
+		keepTimeKey: opts.KeepTimeKey,
+	}
+	if opts.Timezone != "" {
+		location, err := loadTimezone(opts.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		base.location = location
+	}
+	if opts.TimeKey != "" {
+		timeKey, err := NewRecordAccessor(opts.TimeKey)
+		if err != nil {
+			return nil, err
+		}
+		base.timeKey = timeKey
+	}
+
+	switch opts.Format {
+	case "", "none", "text":
+		messageKey := opts.MessageKey
+		if messageKey == "" {
+			messageKey = "message"
+		}
+		accessor, err := NewRecordAccessor(messageKey)
+		if err != nil {
+			return nil, err
+		}
+		return &noneParser{baseParser: base, messageKey: accessor}, nil
+	case "json":
+		return &jsonParser{baseParser: base}, nil
+	case "regex", "regexp":
+		if opts.Expression == "" {
+			return nil, fmt.Errorf("regex parser requires an expression")
+		}
+		expression, err := regexp.Compile(opts.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression: %v", err)
+		}
+		return &regexParser{baseParser: base, expression: expression}, nil
+	case "logfmt", "kv":
+		return &logfmtParser{baseParser: base}, nil
+	case "ltsv":
+		return &ltsvParser{baseParser: base}, nil
+	}
+	return nil, fmt.Errorf("unknown parser format: %s", opts.Format)
+}
+
+// baseParser 处理所有格式共用的时间字段提取
+type baseParser struct {
+	timeKey     *RecordAccessor
+	timeFormat  string
+	location    *time.Location
+	keepTimeKey bool
+}
+
+func (p *baseParser) extractTime(record map[string]interface{}) (time.Time, error) {
+	if p.timeKey == nil {
+		return time.Time{}, nil
+	}
+	value, ok := p.timeKey.Get(record)
+	if !ok {
+		return time.Time{}, nil
+	}
+	t, err := parseEventTime(value, p.timeFormat, p.location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %v: %v", value, err)
+	}
+	if !p.keepTimeKey {
+		p.timeKey.Delete(record)
+	}
+	return t, nil
+}
+
+type noneParser struct {
+	baseParser
+	messageKey *RecordAccessor
+}
+
+func (p *noneParser) Parse(text string) (map[string]interface{}, time.Time, error) {
+	record := make(map[string]interface{})
+	err := p.messageKey.Set(record, text)
+	return record, time.Time{}, err
+}
+
+type jsonParser struct {
+	baseParser
+}
+
+func (p *jsonParser) Parse(text string) (map[string]interface{}, time.Time, error) {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, time.Time{}, err
+	}
+	record, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, time.Time{}, fmt.Errorf("json value is %s, not an object", jsonKind(value))
+	}
+	normalizeJSONNumbers(record)
+	t, err := p.extractTime(record)
+	return record, t, err
+}
+
+type regexParser struct {
+	baseParser
+	expression *regexp.Regexp
+}
+
+func (p *regexParser) Parse(text string) (map[string]interface{}, time.Time, error) {
+	match := p.expression.FindStringSubmatch(text)
+	if match == nil {
+		return nil, time.Time{}, fmt.Errorf("pattern not matched")
+	}
+	record := make(map[string]interface{})
+	for i, name := range p.expression.SubexpNames() {
+		if name != "" && i < len(match) {
+			record[name] = match[i]
+		}
+	}
+	t, err := p.extractTime(record)
+	return record, t, err
+}
+
+// logfmtParser 解析 key=value key2="quoted value" 格式
+type logfmtParser struct {
+	baseParser
+}
+
+func (p *logfmtParser) Parse(text string) (map[string]interface{}, time.Time, error) {
+	record := make(map[string]interface{})
+	for i := 0; i < len(text); {
+		for i < len(text) && text[i] == ' ' {
+			i++
+		}
+		start := i
+		for i < len(text) && text[i] != '=' && text[i] != ' ' {
+			i++
+		}
+		key := text[start:i]
+		if key == "" {
+			i++
+			continue
+		}
+		if i >= len(text) || text[i] != '=' {
+			// 没有值的 key 视为 true
+			record[key] = true
+			continue
+		}
+		i++
+
+		var value string
+		if i < len(text) && text[i] == '"' {
+			end := i + 1
+			for end < len(text) && text[end] != '"' {
+				if text[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(text) {
+				return nil, time.Time{}, fmt.Errorf("unterminated quote for key %s", key)
+			}
+			unquoted, err := strconv.Unquote(text[i : end+1])
+			if err != nil {
+				unquoted = text[i+1 : end]
+			}
+			value = unquoted
+			i = end + 1
+		} else {
+			start = i
+			for i < len(text) && text[i] != ' ' {
+				i++
+			}
+			value = text[start:i]
+		}
+		record[key] = value
+	}
+	if len(record) == 0 {
+		return nil, time.Time{}, fmt.Errorf("no key=value pairs found")
+	}
+	t, err := p.extractTime(record)
+	return record, t, err
+}
+
+// ltsvParser 解析以制表符分隔的 label:value 格式
+type ltsvParser struct {
+	baseParser
+}
+
+func (p *ltsvParser) Parse(text string) (map[string]interface{}, time.Time, error) {
+	record := make(map[string]interface{})
+	for _, field := range strings.Split(text, "\t") {
+		label, value, ok := strings.Cut(field, ":")
+		if !ok {
+			return nil, time.Time{}, fmt.Errorf("invalid ltsv field: %s", field)
+		}
+		record[label] = value
+	}
+	t, err := p.extractTime(record)
+	return record, t, err
+}
+
+// jsonKind 返回解码后的 JSON 值的类型名称，用于错误信息
+func jsonKind(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case []interface{}:
+		return "an array"
+	case string:
+		return "a string"
+	case json.Number:
+		return "a number"
+	case bool:
+		return "a boolean"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// normalizeJSONNumbers 将 json.Number 转换为 int64 或 float64
+func normalizeJSONNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeJSONNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeJSONNumbers(item)
+		}
+	}
+	return value
+}
+
+// parseEventTime 按格式解析时间值，格式为 unix、unix_ms、unix_us、unix_ns、strptime 格式
+// (包含 %，见 strptimeLayout) 或 Go 时间布局，为空时按 RFC3339 解析字符串、按秒解析数字。
+// loc 为时间字符串中没有时区时使用的时区，nil 表示 UTC
+func parseEventTime(value interface{}, format string, loc *time.Location) (time.Time, error) {
+	if format == "%s" {
+		format = "unix"
+	}
+	switch format {
+	case "unix", "unix_ms", "unix_us", "unix_ns":
+		var n int64
+		switch v := value.(type) {
+		case int64:
+			n = v
+		case int:
+			n = int64(v)
+		case float64:
+			if format == "unix" {
+				sec := int64(v)
+				return time.Unix(sec, int64((v-float64(sec))*1e9)), nil
+			}
+			n = int64(v)
+		case string:
+			i, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				f, ferr := strconv.ParseFloat(v, 64)
+				if ferr != nil {
+					return time.Time{}, err
+				}
+				return parseEventTime(f, format, loc)
+			}
+			n = i
+		default:
+			return time.Time{}, fmt.Errorf("unsupported type %T", value)
+		}
+		switch format {
+		case "unix":
+			return time.Unix(n, 0), nil
+		case "unix_ms":
+			return time.UnixMilli(n), nil
+		case "unix_us":
+			return time.UnixMicro(n), nil
+		default:
+			return time.Unix(0, n), nil
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		layout := format
+		if layout == "" {
+			layout = time.RFC3339Nano
+		} else if strings.Contains(layout, "%") {
+			layout = strptimeLayout(layout)
+		}
+		if loc != nil {
+			return time.ParseInLocation(layout, v, loc)
+		}
+		return time.Parse(layout, v)
+	case int64, int, float64:
+		if format != "" {
+			return time.Time{}, fmt.Errorf("numeric time %v does not match format %q", v, format)
+		}
+		return parseEventTime(v, "unix", nil)
+	}
+	return time.Time{}, fmt.Errorf("unsupported type %T", value)
+}
@@ -0,0 +1,128 @@
+package plugin
+
+import (
+	"fmt"
+	"log"
+)
+
+// ParserFilterOptions parser 过滤插件的配置
+type ParserFilterOptions struct {
+	// KeyName 要解析的字段，支持 record accessor 语法
+	KeyName string
+	Parser  Parser
+	// ReserveData 为 true 时保留原记录的字段，解析结果合并进去
+	ReserveData bool
+	// ReserveTime 为 true 时不使用解析结果中的时间
+	ReserveTime bool
+	// InjectKeyPrefix 给解析出的字段名加上前缀
+	InjectKeyPrefix string
+	// HashValueField 不为空时解析结果整体写入这个字段
+	HashValueField string
+	// RemoveKeyNameField 为 true 时在保留原记录的情况下删除被解析的字段
+	RemoveKeyNameField bool
+}
+
+// ParserFilter 用解析器解析记录中的一个字段，例如 Docker 日志中的 log 字段
+type ParserFilter struct {
+	*BaseFilter
+	key                *RecordAccessor
+	parser             Parser
+	reserveData        bool
+	reserveTime        bool
+	injectKeyPrefix    string
+	hashValueField     *RecordAccessor
+	removeKeyNameField bool
+}
+
+// NewParserFilter 创建一个新的解析过滤插件
+func NewParserFilter(inputQueue, outputQueue *Queue, matchTag string, opts ParserFilterOptions) (*ParserFilter, error) {
+	if opts.KeyName == "" {
+		return nil, fmt.Errorf("parser filter requires a key")
+	}
+	key, err := NewRecordAccessor(opts.KeyName)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &ParserFilter{
+		BaseFilter:         NewBaseFilter(inputQueue, outputQueue, matchTag),
+		key:                key,
+		parser:             opts.Parser,
+		reserveData:        opts.ReserveData,
+		reserveTime:        opts.ReserveTime,
+		injectKeyPrefix:    opts.InjectKeyPrefix,
+		removeKeyNameField: opts.RemoveKeyNameField,
+	}
+	if opts.HashValueField != "" {
+		if p.hashValueField, err = NewRecordAccessor(opts.HashValueField); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Filter 解析字段。字段不存在或解析失败时，reserve_data 为 true 则原样传递，否则丢弃
+func (p *ParserFilter) Filter(event *Event) *Event {
+	raw, ok := p.key.Get(event.Record)
+	if !ok {
+		log.Printf("Parser filter: key %s not found in event with tag %s", p.key, event.Tag)
+		return p.fallback(event)
+	}
+
+	parsed, t, err := p.parser.Parse(toString(raw))
+	if err != nil {
+		log.Printf("Parser filter: failed to parse %s: %v", p.key, err)
+		return p.fallback(event)
+	}
+
+	if p.injectKeyPrefix != "" {
+		prefixed := make(map[string]interface{}, len(parsed))
+		for k, v := range parsed {
+			prefixed[p.injectKeyPrefix+k] = v
+		}
+		parsed = prefixed
+	}
+
+	record := make(map[string]interface{})
+	if p.reserveData {
+		for k, v := range event.Record {
+			record[k] = v
+		}
+		if p.removeKeyNameField {
+			p.key.Delete(record)
+		}
+	}
+
+	if p.hashValueField != nil {
+		if err := p.hashValueField.Set(record, parsed); err != nil {
+			log.Printf("Parser filter: failed to set %s: %v", p.hashValueField, err)
+		}
+	} else {
+		for k, v := range parsed {
+			record[k] = v
+		}
+	}
+
+	event.Record = record
+	if !p.reserveTime && !t.IsZero() {
+		event.Timestamp = t
+	}
+	return event
+}
+
+func (p *ParserFilter) fallback(event *Event) *Event {
+	if p.reserveData {
+		return event
+	}
+	return nil
+}
+
+// Start 启动过滤插件
+func (p *ParserFilter) Start() {
+	p.startLoop("ParserFilter", p.Filter)
+}
+
+// Stop 停止过滤插件
+func (p *ParserFilter) Stop() {
+	p.stopLoop("ParserFilter")
+}
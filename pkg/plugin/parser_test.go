@@ -0,0 +1,273 @@
+package plugin
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParser(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    ParserOptions
+		text    string
+		want    map[string]interface{}
+		time    time.Time
+		wantErr bool
+	}{
+		{
+			name: "none",
+			text: "hello world",
+			want: map[string]interface{}{"message": "hello world"},
+		},
+		{
+			name: "none with message key",
+			opts: ParserOptions{MessageKey: "$.log.raw"},
+			text: "hello",
+			want: map[string]interface{}{"log": map[string]interface{}{"raw": "hello"}},
+		},
+		{
+			name: "json numbers",
+			opts: ParserOptions{Format: "json"},
+			text: `{"n": 1, "f": 1.5, "big": 9007199254740993, "nested": {"list": [2, "x"]}}`,
+			want: map[string]interface{}{
+				"n": int64(1), "f": 1.5, "big": int64(9007199254740993),
+				"nested": map[string]interface{}{"list": []interface{}{int64(2), "x"}},
+			},
+		},
+		{
+			name: "json time key",
+			opts: ParserOptions{Format: "json", TimeKey: "ts", TimeFormat: "unix"},
+			text: `{"ts": 1700000000, "message": "hi"}`,
+			want: map[string]interface{}{"message": "hi"},
+			time: time.Unix(1700000000, 0),
+		},
+		{
+			name: "json keep time key",
+			opts: ParserOptions{Format: "json", TimeKey: "ts", KeepTimeKey: true},
+			text: `{"ts": "2024-01-02T03:04:05Z"}`,
+			want: map[string]interface{}{"ts": "2024-01-02T03:04:05Z"},
+			time: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+		{name: "json null", opts: ParserOptions{Format: "json"}, text: "null", wantErr: true},
+		{name: "json array", opts: ParserOptions{Format: "json"}, text: "[1,2]", wantErr: true},
+		{name: "json string", opts: ParserOptions{Format: "json"}, text: `"str"`, wantErr: true},
+		{name: "json number", opts: ParserOptions{Format: "json"}, text: "42", wantErr: true},
+		{name: "json invalid", opts: ParserOptions{Format: "json"}, text: `{"a":`, wantErr: true},
+		{
+			name:    "json invalid time",
+			opts:    ParserOptions{Format: "json", TimeKey: "ts"},
+			text:    `{"ts": "yesterday"}`,
+			wantErr: true,
+		},
+		{
+			name: "regex",
+			opts: ParserOptions{Format: "regex", Expression: `^(?P<level>\w+) (?P<message>.*)$`},
+			text: "INFO started",
+			want: map[string]interface{}{"level": "INFO", "message": "started"},
+		},
+		{
+			name:    "regex not matched",
+			opts:    ParserOptions{Format: "regex", Expression: `^(?P<level>\d+)$`},
+			text:    "INFO",
+			wantErr: true,
+		},
+		{
+			name: "logfmt",
+			opts: ParserOptions{Format: "logfmt"},
+			text: `level=info msg="disk \"sda\" full" debug`,
+			want: map[string]interface{}{"level": "info", "msg": `disk "sda" full`, "debug": true},
+		},
+		{name: "logfmt unterminated quote", opts: ParserOptions{Format: "logfmt"}, text: `msg="open`, wantErr: true},
+		{name: "logfmt empty", opts: ParserOptions{Format: "logfmt"}, text: "   ", wantErr: true},
+		{
+			name: "ltsv",
+			opts: ParserOptions{Format: "ltsv"},
+			text: "host:127.0.0.1\ttime:2024-01-02T03:04:05+08:00",
+			want: map[string]interface{}{"host": "127.0.0.1", "time": "2024-01-02T03:04:05+08:00"},
+		},
+		{name: "ltsv invalid field", opts: ParserOptions{Format: "ltsv"}, text: "host", wantErr: true},
+		{
+			name: "strptime in timezone",
+			opts: ParserOptions{Format: "ltsv", TimeKey: "time", TimeFormat: "%Y-%m-%d %H:%M:%S", Timezone: "+08:00"},
+			text: "time:2024-01-02 03:04:05",
+			want: map[string]interface{}{},
+			time: time.Date(2024, 1, 1, 19, 4, 5, 0, time.UTC),
+		},
+		{
+			name: "types",
+			opts: ParserOptions{Format: "logfmt", Types: map[string]string{"status": "integer", "ok": "bool"}},
+			text: "status=200 ok=yes",
+			want: map[string]interface{}{"status": int64(200), "ok": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser, err := NewParser(tt.opts)
+			if err != nil {
+				t.Fatalf("NewParser: %v", err)
+			}
+			record, ts, err := parser.Parse(tt.text)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Parse(%q) = %v, want error", tt.text, record)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.text, err)
+			}
+			if !reflect.DeepEqual(record, tt.want) {
+				t.Errorf("record = %#v, want %#v", record, tt.want)
+			}
+			if !ts.Equal(tt.time) {
+				t.Errorf("time = %v, want %v", ts, tt.time)
+			}
+		})
+	}
+}
+
+func TestNewParserErrors(t *testing.T) {
+	for _, opts := range []ParserOptions{
+		{Format: "xml"},
+		{Format: "regex"},
+		{Format: "regex", Expression: "("},
+		{Format: "json", Timezone: "Mars/Olympus"},
+		{Format: "json", Types: map[string]string{"a": "decimal"}},
+	} {
+		if _, err := NewParser(opts); err == nil {
+			t.Errorf("NewParser(%+v): want error", opts)
+		}
+	}
+}
+
+func TestParserFilter(t *testing.T) {
+	original := time.Unix(1600000000, 0)
+	parsedTime := time.Unix(1700000000, 0)
+	tests := []struct {
+		name   string
+		opts   ParserFilterOptions
+		record map[string]interface{}
+		// want 为 nil 时期望事件被丢弃
+		want map[string]interface{}
+		time time.Time
+	}{
+		{
+			name:   "replace record",
+			opts:   ParserFilterOptions{KeyName: "log"},
+			record: map[string]interface{}{"log": `{"level": "info", "ts": 1700000000}`, "stream": "stdout"},
+			want:   map[string]interface{}{"level": "info"},
+			time:   parsedTime,
+		},
+		{
+			name:   "reserve data",
+			opts:   ParserFilterOptions{KeyName: "log", ReserveData: true},
+			record: map[string]interface{}{"log": `{"level": "info"}`, "stream": "stdout"},
+			want:   map[string]interface{}{"log": `{"level": "info"}`, "level": "info", "stream": "stdout"},
+			time:   original,
+		},
+		{
+			name:   "remove key name field",
+			opts:   ParserFilterOptions{KeyName: "log", ReserveData: true, RemoveKeyNameField: true},
+			record: map[string]interface{}{"log": `{"level": "info"}`, "stream": "stdout"},
+			want:   map[string]interface{}{"level": "info", "stream": "stdout"},
+			time:   original,
+		},
+		{
+			name:   "parsed fields override",
+			opts:   ParserFilterOptions{KeyName: "log", ReserveData: true},
+			record: map[string]interface{}{"log": `{"stream": "parsed"}`, "stream": "stdout"},
+			want:   map[string]interface{}{"log": `{"stream": "parsed"}`, "stream": "parsed"},
+			time:   original,
+		},
+		{
+			name:   "inject key prefix",
+			opts:   ParserFilterOptions{KeyName: "log", InjectKeyPrefix: "app_"},
+			record: map[string]interface{}{"log": `{"level": "info"}`},
+			want:   map[string]interface{}{"app_level": "info"},
+			time:   original,
+		},
+		{
+			name:   "hash value field",
+			opts:   ParserFilterOptions{KeyName: "log", ReserveData: true, RemoveKeyNameField: true, HashValueField: "$.parsed.log"},
+			record: map[string]interface{}{"log": `{"level": "info"}`, "stream": "stdout"},
+			want:   map[string]interface{}{"parsed": map[string]interface{}{"log": map[string]interface{}{"level": "info"}}, "stream": "stdout"},
+			time:   original,
+		},
+		{
+			name:   "reserve time",
+			opts:   ParserFilterOptions{KeyName: "log", ReserveTime: true},
+			record: map[string]interface{}{"log": `{"ts": 1700000000}`},
+			want:   map[string]interface{}{},
+			time:   original,
+		},
+		{
+			name:   "nested key",
+			opts:   ParserFilterOptions{KeyName: "$.docker.log"},
+			record: map[string]interface{}{"docker": map[string]interface{}{"log": `{"level": "warn"}`}},
+			want:   map[string]interface{}{"level": "warn"},
+			time:   original,
+		},
+		{
+			name:   "missing key dropped",
+			opts:   ParserFilterOptions{KeyName: "log"},
+			record: map[string]interface{}{"message": "x"},
+		},
+		{
+			name:   "missing key kept with reserve data",
+			opts:   ParserFilterOptions{KeyName: "log", ReserveData: true},
+			record: map[string]interface{}{"message": "x"},
+			want:   map[string]interface{}{"message": "x"},
+			time:   original,
+		},
+		{
+			name:   "parse error dropped",
+			opts:   ParserFilterOptions{KeyName: "log"},
+			record: map[string]interface{}{"log": "not json"},
+		},
+		{
+			name:   "json null dropped",
+			opts:   ParserFilterOptions{KeyName: "log"},
+			record: map[string]interface{}{"log": "null"},
+		},
+		{
+			name:   "parse error kept with reserve data",
+			opts:   ParserFilterOptions{KeyName: "log", ReserveData: true},
+			record: map[string]interface{}{"log": "[1, 2]"},
+			want:   map[string]interface{}{"log": "[1, 2]"},
+			time:   original,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser, err := NewParser(ParserOptions{Format: "json", TimeKey: "ts", TimeFormat: "unix"})
+			if err != nil {
+				t.Fatalf("NewParser: %v", err)
+			}
+			tt.opts.Parser = parser
+			p, err := NewParserFilter(NewQueue(1), NewQueue(1), "**", tt.opts)
+			if err != nil {
+				t.Fatalf("NewParserFilter: %v", err)
+			}
+
+			event := NewEvent("app", tt.record)
+			event.Timestamp = original
+			got := p.Filter(event)
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("Filter = %v, want the event dropped", got.Record)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("Filter dropped the event")
+			}
+			if !reflect.DeepEqual(got.Record, tt.want) {
+				t.Errorf("record = %#v, want %#v", got.Record, tt.want)
+			}
+			if !got.Timestamp.Equal(tt.time) {
+				t.Errorf("timestamp = %v, want %v", got.Timestamp, tt.time)
+			}
+		})
+	}
+}
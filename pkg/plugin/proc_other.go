@@ -0,0 +1,8 @@
+//go:build !unix
+
+package plugin
+
+import "os/exec"
+
+// setProcessGroup 非 unix 平台没有进程组，取消时只杀死命令本身
+func setProcessGroup(cmd *exec.Cmd) {}
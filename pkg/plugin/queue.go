@@ -1,6 +1,10 @@
 package plugin
 
-import "sync"
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 // Queue 用于在组件间传递事件的队列
 type Queue struct {
@@ -8,6 +12,8 @@ type Queue struct {
 	capacity int
 	mu       sync.Mutex
 	closed   bool
+	// dropped 因队列已满或已关闭而没有放入的事件数
+	dropped atomic.Int64
 }
 
 func NewQueue(capacity int) *Queue {
@@ -18,7 +24,36 @@ func NewQueue(capacity int) *Queue {
 	}
 }
 
+// Put 放入事件，队列已满或已关闭时返回 false，并计入 Dropped
 func (q *Queue) Put(event *Event) bool {
+	if q.offer(event) {
+		return true
+	}
+	q.dropped.Add(1)
+	return false
+}
+
+// putWait 队列已满时等待下游消费，直到放入成功或 running 返回 false，
+// 只有最终没有放入时才计入 Dropped
+func (q *Queue) putWait(event *Event, running func() bool) bool {
+	for !q.offer(event) {
+		if q.isClosed() || !running() {
+			q.dropped.Add(1)
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+func (q *Queue) isClosed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closed
+}
+
+// offer 尝试放入事件，失败时不计数
+func (q *Queue) offer(event *Event) bool {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
@@ -64,3 +99,8 @@ func (q *Queue) Close() {
 func (q *Queue) Len() int {
 	return len(q.ch)
 }
+
+// Dropped 返回因队列已满或已关闭而丢弃的事件数
+func (q *Queue) Dropped() int64 {
+	return q.dropped.Load()
+}
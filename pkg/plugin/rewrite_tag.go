@@ -0,0 +1,149 @@
+package plugin
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+)
+
+// DefaultMaxTagRewrites 一个事件最多被重写标签的次数
+const DefaultMaxTagRewrites = 4
+
+// captureReference 匹配标签模板中的 $1、$2 等捕获组引用
+var captureReference = regexp.MustCompile(`\$(\d+)`)
+
+// RewriteTagRule 一条 rewrite_tag 规则：key 的值匹配 pattern 时
+// (Invert 为 true 时为不匹配) 事件以 Tag 作为新标签重新发出。
+// Tag 中 $1 等引用 pattern 的捕获组，${...} 为表达式占位符，
+// 可以使用 tag、tag_parts、tag_prefix、tag_suffix、hostname 和 record
+type RewriteTagRule struct {
+	Key     string
+	Pattern string
+	Tag     string
+	Invert  bool
+}
+
+// RewriteTagOptions rewrite_tag 过滤插件的配置
+type RewriteTagOptions struct {
+	Rules []RewriteTagRule
+	// MaxRewrites 一个事件最多被重写的次数，超过后不再重写，默认为 DefaultMaxTagRewrites
+	MaxRewrites int
+}
+
+type rewriteTagRule struct {
+	grepMatcher
+	tag    *valueTemplate
+	invert bool
+}
+
+// RewriteTagFilter 按记录内容重写事件的标签。规则按顺序检查，第一个命中的规则生效，
+// 新事件放回流水线的入口重新经过所有过滤插件和路由，原事件被移除；
+// 没有命中任何规则的事件原样通过
+type RewriteTagFilter struct {
+	*BaseFilter
+	emitQueue   *Queue
+	rules       []rewriteTagRule
+	maxRewrites int
+	hostname    string
+}
+
+var rewriteTagVariables = []string{"tag", "tag_parts", "tag_prefix", "tag_suffix", "hostname", "record", "captures"}
+
+// NewRewriteTagFilter 创建一个新的 rewrite_tag 过滤插件，emitQueue 为重写后事件放回的队列
+func NewRewriteTagFilter(inputQueue, outputQueue, emitQueue *Queue, matchTag string, opts RewriteTagOptions) (*RewriteTagFilter, error) {
+	if len(opts.Rules) == 0 {
+		return nil, fmt.Errorf("rewrite_tag filter requires at least one rule")
+	}
+	if opts.MaxRewrites <= 0 {
+		opts.MaxRewrites = DefaultMaxTagRewrites
+	}
+	hostname, _ := os.Hostname()
+
+	r := &RewriteTagFilter{
+		BaseFilter:  NewBaseFilter(inputQueue, outputQueue, matchTag),
+		emitQueue:   emitQueue,
+		maxRewrites: opts.MaxRewrites,
+		hostname:    hostname,
+	}
+	for _, rule := range opts.Rules {
+		matcher, err := newGrepMatcher(GrepRule{Key: rule.Key, Pattern: rule.Pattern})
+		if err != nil {
+			return nil, err
+		}
+		if rule.Tag == "" {
+			return nil, fmt.Errorf("rewrite_tag rule for %s requires a tag", rule.Key)
+		}
+		source := captureReference.ReplaceAllString(rule.Tag, "${captures[$1]}")
+		tag, err := compileValueTemplate(source, rewriteTagVariables)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag for %s: %v", rule.Key, err)
+		}
+		r.rules = append(r.rules, rewriteTagRule{grepMatcher: matcher, tag: tag, invert: rule.Invert})
+	}
+	return r, nil
+}
+
+// newTag 返回第一个命中规则生成的新标签，没有命中时返回 false
+func (r *RewriteTagFilter) newTag(event *Event) (string, bool, error) {
+	for _, rule := range r.rules {
+		value, ok := rule.key.Get(event.Record)
+		var match []string
+		if ok && value != nil {
+			match = rule.pattern.FindStringSubmatch(toString(value))
+		}
+		if (match != nil) == rule.invert {
+			continue
+		}
+
+		captures := make([]interface{}, len(match))
+		for i, s := range match {
+			captures[i] = s
+		}
+		vars := tagVariables(event.Tag)
+		vars["hostname"] = r.hostname
+		vars["record"] = event.Record
+		vars["captures"] = captures
+
+		tag, err := rule.tag.render(vars)
+		if err != nil {
+			return "", false, err
+		}
+		return toString(tag), true, nil
+	}
+	return "", false, nil
+}
+
+// Filter 执行过滤操作，重写标签的事件放回入口队列，返回 nil
+func (r *RewriteTagFilter) Filter(event *Event) *Event {
+	tag, ok, err := r.newTag(event)
+	if err != nil {
+		log.Printf("Error rewriting tag %s: %v", event.Tag, err)
+		return event
+	}
+	if !ok || tag == "" || tag == event.Tag {
+		return event
+	}
+	if event.rewrites >= r.maxRewrites {
+		log.Printf("Not rewriting tag %s to %s: event was already rewritten %d times, check rewrite_tag rules for loops",
+			event.Tag, tag, event.rewrites)
+		return event
+	}
+
+	event.Tag = tag
+	event.rewrites++
+	if !r.emitQueue.Put(event) {
+		log.Printf("Dropped event rewritten to tag %s because the queue was full", tag)
+	}
+	return nil
+}
+
+// Start 启动过滤插件
+func (r *RewriteTagFilter) Start() {
+	r.startLoop("RewriteTagFilter", r.Filter)
+}
+
+// Stop 停止过滤插件
+func (r *RewriteTagFilter) Stop() {
+	r.stopLoop("RewriteTagFilter")
+}
@@ -0,0 +1,135 @@
+package plugin
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Router 将过滤后的事件按标签分发到各个输出插件的队列，
+// 一个事件匹配多个输出时每个输出都会收到一份拷贝
+type Router struct {
+	inputQueue *Queue
+	routes     []route
+	running    bool
+	blocking   bool
+	mu         sync.Mutex
+	wg         sync.WaitGroup
+}
+
+type route struct {
+	matcher *TagMatcher
+	queue   *Queue
+}
+
+// NewRouter 创建一个新的路由
+func NewRouter(inputQueue *Queue) *Router {
+	return &Router{
+		inputQueue: inputQueue,
+	}
+}
+
+// AddRoute 添加一条路由，标签匹配 pattern 的事件会被放入 queue
+func (r *Router) AddRoute(pattern string, queue *Queue) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes = append(r.routes, route{matcher: NewTagMatcher(pattern), queue: queue})
+}
+
+// IsRunning 检查路由是否在运行
+func (r *Router) IsRunning() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.running
+}
+
+// SetRunning 设置路由运行状态
+func (r *Router) SetRunning(running bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.running = running
+}
+
+// SetBlocking 设置输出队列满时是否等待输出插件消费，一次性管道 (stdin 输入) 不能丢事件时使用
+func (r *Router) SetBlocking(blocking bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.blocking = blocking
+}
+
+func (r *Router) put(queue *Queue, event *Event) {
+	r.mu.Lock()
+	blocking := r.blocking
+	r.mu.Unlock()
+	if blocking {
+		queue.putWait(event, r.IsRunning)
+	} else {
+		queue.Put(event)
+	}
+}
+
+// Route 分发一个事件，没有匹配的输出时丢弃
+func (r *Router) Route(event *Event) {
+	first := true
+	for _, route := range r.routes {
+		if !route.matcher.Match(event.Tag) {
+			continue
+		}
+		if first {
+			r.put(route.queue, event)
+			first = false
+		} else {
+			r.put(route.queue, event.Copy())
+		}
+	}
+}
+
+// Start 启动路由
+func (r *Router) Start() {
+	if r.IsRunning() {
+		return
+	}
+
+	r.SetRunning(true)
+	r.wg.Add(1)
+
+	go func() {
+		defer r.wg.Done()
+		log.Println("Starting Router")
+
+		for r.IsRunning() {
+			event, ok := r.inputQueue.Get()
+			if !ok {
+				// 队列已关闭或无数据，短暂休眠
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			r.Route(event)
+		}
+	}()
+}
+
+// Stop 停止路由，输入队列中剩余的事件在退出前分发完
+func (r *Router) Stop() {
+	if !r.IsRunning() {
+		return
+	}
+
+	r.SetRunning(false)
+	r.wg.Wait()
+	r.drain()
+	log.Println("Stopped Router")
+}
+
+// drain 分发完输入队列中剩余的事件，有事件被分发时返回 true
+func (r *Router) drain() bool {
+	drained := false
+	for {
+		event, ok := r.inputQueue.Get()
+		if !ok {
+			return drained
+		}
+		r.Route(event)
+		drained = true
+	}
+}
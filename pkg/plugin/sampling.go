@@ -0,0 +1,142 @@
+package plugin
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"sync"
+)
+
+// SamplingOptions sampling 过滤插件的配置，Rate 和 Percent 二选一
+type SamplingOptions struct {
+	// Rate 每 Rate 个事件保留一个
+	Rate int
+	// Percent 保留的百分比，0 到 100
+	Percent float64
+	// GroupKeys 分组字段，每个分组单独按比例采样，支持 record accessor 语法
+	GroupKeys []string
+	// HashKey 不为空时按这个字段值的哈希决定是否保留，值相同的事件 (例如同一个 trace_id)
+	// 要么都保留要么都丢弃；事件没有这个字段时按分组计数采样
+	HashKey string
+	// Keep 满足这个条件的事件总是保留，例如 level 为 ERROR 的事件
+	Keep *Condition
+	// MaxGroups 最多记录的分组数，默认为 DefaultThrottleMaxGroups
+	MaxGroups int
+}
+
+// SamplingFilter 按比例保留事件
+type SamplingFilter struct {
+	*BaseFilter
+	rate      int64
+	fraction  float64
+	groupKeys []*RecordAccessor
+	hashKey   *RecordAccessor
+	keep      *Condition
+
+	countsMu sync.Mutex
+	counts   *lruCache[string, *int64]
+}
+
+// NewSamplingFilter 创建一个新的采样过滤插件
+func NewSamplingFilter(inputQueue, outputQueue *Queue, matchTag string, opts SamplingOptions) (*SamplingFilter, error) {
+	var fraction float64
+	switch {
+	case opts.Rate > 0 && opts.Percent > 0:
+		return nil, fmt.Errorf("sampling filter accepts either sample_rate or sample_percent, not both")
+	case opts.Rate > 0:
+		fraction = 1 / float64(opts.Rate)
+	case opts.Percent > 0 && opts.Percent <= 100:
+		fraction = opts.Percent / 100
+	default:
+		return nil, fmt.Errorf("sampling filter requires sample_rate >= 1 or sample_percent in (0, 100]")
+	}
+	if opts.MaxGroups <= 0 {
+		opts.MaxGroups = DefaultThrottleMaxGroups
+	}
+
+	s := &SamplingFilter{
+		BaseFilter: NewBaseFilter(inputQueue, outputQueue, matchTag),
+		rate:       int64(opts.Rate),
+		fraction:   fraction,
+		keep:       opts.Keep,
+		counts:     newLRUCache[string, *int64](opts.MaxGroups),
+	}
+	for _, key := range opts.GroupKeys {
+		accessor, err := NewRecordAccessor(key)
+		if err != nil {
+			return nil, err
+		}
+		s.groupKeys = append(s.groupKeys, accessor)
+	}
+	if opts.HashKey != "" {
+		accessor, err := NewRecordAccessor(opts.HashKey)
+		if err != nil {
+			return nil, err
+		}
+		s.hashKey = accessor
+	}
+	return s, nil
+}
+
+// sampleHash 按值的哈希决定是否保留，同一个值的结果总是相同
+func (s *SamplingFilter) sampleHash(value interface{}) bool {
+	h := fnv.New64a()
+	h.Write([]byte(toString(value)))
+	return float64(h.Sum64()%1000000) < s.fraction*1000000
+}
+
+// sampleCount 按分组计数采样，每个分组保留的比例均匀且确定，第一个事件总是保留：
+// 按 Rate 采样时保留第 0、Rate、2*Rate... 个事件，按百分比采样时在 floor(n*fraction) 增加时保留
+func (s *SamplingFilter) sampleCount(record map[string]interface{}) bool {
+	parts := make([]string, len(s.groupKeys))
+	for i, key := range s.groupKeys {
+		value, _ := key.Get(record)
+		parts[i] = toString(value)
+	}
+	group := strings.Join(parts, "\x00")
+
+	s.countsMu.Lock()
+	defer s.countsMu.Unlock()
+
+	count, ok := s.counts.Get(group)
+	if !ok {
+		count = new(int64)
+		s.counts.Add(group, count)
+	}
+	n := *count
+	*count++
+	if s.rate > 0 {
+		return n%s.rate == 0
+	}
+	return math.Floor(float64(n)*s.fraction) > math.Floor(float64(n-1)*s.fraction)
+}
+
+// Filter 执行过滤操作
+func (s *SamplingFilter) Filter(event *Event) *Event {
+	if s.keep != nil && s.keep.Evaluate(event.Record) {
+		return event
+	}
+	if s.hashKey != nil {
+		if value, ok := s.hashKey.Get(event.Record); ok && value != nil {
+			if s.sampleHash(value) {
+				return event
+			}
+			return nil
+		}
+	}
+	if s.sampleCount(event.Record) {
+		return event
+	}
+	return nil
+}
+
+// Start 启动过滤插件
+func (s *SamplingFilter) Start() {
+	s.startLoop("SamplingFilter", s.Filter)
+}
+
+// Stop 停止过滤插件
+func (s *SamplingFilter) Stop() {
+	s.stopLoop("SamplingFilter")
+}
@@ -0,0 +1,346 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// DefaultScriptTimeout 脚本处理一个事件的默认超时时间
+const DefaultScriptTimeout = time.Second
+
+// ScriptOptions script 过滤插件的配置，Path 和 Source 二选一
+type ScriptOptions struct {
+	// Path Lua 脚本文件，文件修改后自动重新加载
+	Path string
+	// Source 直接写在配置中的 Lua 脚本
+	Source string
+	// Call 每个事件调用的函数名，默认为 filter
+	Call string
+	// Timeout 处理一个事件的超时时间，超时后事件原样通过
+	Timeout time.Duration
+}
+
+// ScriptFilter 对每个事件调用 Lua 函数，调用约定与 Fluent Bit 的 Lua 过滤插件相同：
+//
+//	function filter(tag, timestamp, record)
+//	    return code, timestamp, record
+//	end
+//
+// timestamp 为带小数的 Unix 秒数。code 为 -1 时丢弃事件，0 时事件不变，
+// 1 时使用返回的 timestamp 和 record，2 时只使用返回的 record。
+// 返回的 record 是记录数组时，每个记录作为一个事件发出。
+// 脚本只能使用 base、table、string 和 math 库，不能访问文件和系统命令
+type ScriptFilter struct {
+	*BaseFilter
+	path     string
+	call     string
+	timeout  time.Duration
+	observer *FileObserver
+
+	stateMu sync.Mutex
+	state   *lua.LState
+	fn      *lua.LFunction
+	source  []byte
+}
+
+// NewScriptFilter 创建一个新的脚本过滤插件，脚本无法编译或找不到函数时返回错误
+func NewScriptFilter(inputQueue, outputQueue *Queue, matchTag string, opts ScriptOptions) (*ScriptFilter, error) {
+	if (opts.Path == "") == (opts.Source == "") {
+		return nil, fmt.Errorf("script filter requires either a path or a source")
+	}
+	if opts.Call == "" {
+		opts.Call = "filter"
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultScriptTimeout
+	}
+
+	s := &ScriptFilter{
+		BaseFilter: NewBaseFilter(inputQueue, outputQueue, matchTag),
+		path:       opts.Path,
+		call:       opts.Call,
+		timeout:    opts.Timeout,
+	}
+
+	source := []byte(opts.Source)
+	if opts.Path != "" {
+		var err error
+		if source, err = os.ReadFile(opts.Path); err != nil {
+			return nil, err
+		}
+		s.observer = NewFileObserver(filepath.Dir(opts.Path), func(event FileEvent) {
+			if event.Path == opts.Path && event.Type != FileEventDelete {
+				s.reload()
+			}
+		})
+	}
+	if err := s.load(source); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load 编译脚本并替换当前使用的 Lua 状态
+func (s *ScriptFilter) load(source []byte) error {
+	name := s.path
+	if name == "" {
+		name = "<script>"
+	}
+	chunk, err := parse.Parse(bytes.NewReader(source), name)
+	if err != nil {
+		return fmt.Errorf("parse %s: %v", name, err)
+	}
+	proto, err := lua.Compile(chunk, name)
+	if err != nil {
+		return fmt.Errorf("compile %s: %v", name, err)
+	}
+
+	state := newScriptState()
+	state.Push(state.NewFunctionFromProto(proto))
+	if err := state.PCall(0, lua.MultRet, nil); err != nil {
+		state.Close()
+		return fmt.Errorf("run %s: %v", name, err)
+	}
+	fn, ok := state.GetGlobal(s.call).(*lua.LFunction)
+	if !ok {
+		state.Close()
+		return fmt.Errorf("%s does not define function %s", name, s.call)
+	}
+	state.SetTop(0)
+
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	if s.state != nil {
+		s.state.Close()
+	}
+	s.state, s.fn, s.source = state, fn, source
+	return nil
+}
+
+// reload 脚本文件修改后重新加载，失败时继续使用原来的脚本
+func (s *ScriptFilter) reload() {
+	source, err := os.ReadFile(s.path)
+	if err != nil {
+		log.Printf("Error reading script %s: %v", s.path, err)
+		return
+	}
+	s.stateMu.Lock()
+	unchanged := bytes.Equal(source, s.source)
+	s.stateMu.Unlock()
+	if unchanged {
+		return
+	}
+	if err := s.load(source); err != nil {
+		log.Printf("Error reloading script, keeping the previous version: %v", err)
+		return
+	}
+	log.Printf("Reloaded script %s", s.path)
+}
+
+// newScriptState 创建只加载安全库的 Lua 状态
+func newScriptState() *lua.LState {
+	state := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		state.Push(state.NewFunction(lib.open))
+		state.Push(lua.LString(lib.name))
+		state.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring", "require", "module"} {
+		state.SetGlobal(name, lua.LNil)
+	}
+	return state
+}
+
+// Filter 执行过滤操作，脚本出错或超时时事件原样通过
+func (s *ScriptFilter) Filter(event *Event) *Event {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	state := s.state
+	if state == nil {
+		log.Printf("ScriptFilter is stopped, passing event %s through without running the script", event.Tag)
+		return event
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	state.SetContext(ctx)
+	defer state.RemoveContext()
+
+	timestamp := float64(event.Timestamp.UnixNano()) / 1e9
+	err := state.CallByParam(lua.P{Fn: s.fn, NRet: 3, Protect: true},
+		lua.LString(event.Tag), lua.LNumber(timestamp), toLuaValue(state, event.Record))
+	if err != nil {
+		state.SetTop(0)
+		log.Printf("Error running script for %s: %v", event.Tag, err)
+		return event
+	}
+	code, newTime, result := state.Get(-3), state.Get(-2), state.Get(-1)
+	state.Pop(3)
+
+	n, ok := code.(lua.LNumber)
+	if !ok {
+		log.Printf("Script %s returned invalid code %v", s.call, code)
+		return event
+	}
+	switch int(n) {
+	case -1:
+		return nil
+	case 0:
+		return event
+	case 1:
+		if t, ok := newTime.(lua.LNumber); ok {
+			sec, frac := math.Modf(float64(t))
+			event.Timestamp = time.Unix(int64(sec), int64(frac*1e9))
+		}
+	case 2:
+	default:
+		log.Printf("Script %s returned invalid code %v", s.call, code)
+		return event
+	}
+
+	table, ok := result.(*lua.LTable)
+	if !ok {
+		log.Printf("Script %s returned %s instead of a record", s.call, result.Type())
+		return event
+	}
+	// 记录数组：每个记录作为一个事件
+	if first, ok := table.RawGetInt(1).(*lua.LTable); ok && first != nil {
+		for i := 1; i <= table.Len(); i++ {
+			record, ok := fromLuaValue(table.RawGetInt(i)).(map[string]interface{})
+			if !ok {
+				continue
+			}
+			s.put(&Event{Tag: event.Tag, Timestamp: event.Timestamp, Record: record, rewrites: event.rewrites})
+		}
+		return nil
+	}
+	if record, ok := fromLuaValue(table).(map[string]interface{}); ok {
+		event.Record = record
+	}
+	return event
+}
+
+// toLuaValue 将记录中的值转换为 Lua 值，数组的下标从 1 开始
+func toLuaValue(state *lua.LState, value interface{}) lua.LValue {
+	switch v := value.(type) {
+	case nil:
+		return lua.LNil
+	case string:
+		return lua.LString(v)
+	case bool:
+		return lua.LBool(v)
+	case map[string]interface{}:
+		table := state.CreateTable(0, len(v))
+		for key, item := range v {
+			table.RawSetString(key, toLuaValue(state, item))
+		}
+		return table
+	case []interface{}:
+		table := state.CreateTable(len(v), 0)
+		for _, item := range v {
+			table.Append(toLuaValue(state, item))
+		}
+		return table
+	case time.Time:
+		return lua.LString(v.Format(time.RFC3339Nano))
+	}
+	if n, ok := toNumber(value); ok {
+		return lua.LNumber(n)
+	}
+	return lua.LString(fmt.Sprint(value))
+}
+
+// fromLuaValue 将 Lua 值转换为记录中的值：整数转换为 int64，
+// 键为 1..n 的表转换为数组，其他表转换为 map
+func fromLuaValue(value lua.LValue) interface{} {
+	switch v := value.(type) {
+	case lua.LString:
+		return string(v)
+	case lua.LBool:
+		return bool(v)
+	case lua.LNumber:
+		f := float64(v)
+		if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			return int64(f)
+		}
+		return f
+	case *lua.LTable:
+		if n := v.Len(); n > 0 {
+			count := 0
+			v.ForEach(func(lua.LValue, lua.LValue) { count++ })
+			if count == n {
+				list := make([]interface{}, 0, n)
+				for i := 1; i <= n; i++ {
+					list = append(list, fromLuaValue(v.RawGetInt(i)))
+				}
+				return list
+			}
+		}
+		m := make(map[string]interface{})
+		v.ForEach(func(key, item lua.LValue) {
+			var k string
+			if n, ok := key.(lua.LNumber); ok {
+				k = strconv.FormatFloat(float64(n), 'f', -1, 64)
+			} else {
+				k = key.String()
+			}
+			m[k] = fromLuaValue(item)
+		})
+		return m
+	}
+	return nil
+}
+
+// Start 启动过滤插件
+func (s *ScriptFilter) Start() {
+	if s.IsRunning() {
+		return
+	}
+	s.startLoop("ScriptFilter", s.Filter)
+	if s.observer != nil {
+		s.observer.Start()
+	}
+}
+
+// Stop 停止过滤插件并关闭 Lua 状态
+func (s *ScriptFilter) Stop() {
+	s.halt()
+	s.release()
+}
+
+// halt 停止处理循环和脚本文件的监听，Lua 状态保留到 release
+func (s *ScriptFilter) halt() {
+	if s.observer != nil {
+		s.observer.Stop()
+	}
+	s.stopLoop("ScriptFilter")
+}
+
+// release 关闭 Lua 状态
+func (s *ScriptFilter) release() {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	if s.state != nil {
+		s.state.Close()
+		s.state = nil
+	}
+}
@@ -0,0 +1,231 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScriptFilter(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+	tests := []struct {
+		name    string
+		body    string
+		timeout time.Duration
+		record  map[string]interface{}
+		// want 为 nil 时期望事件被丢弃或拆分
+		want  map[string]interface{}
+		time  time.Time
+		split []map[string]interface{}
+	}{
+		{
+			name:   "drop",
+			body:   "return -1, timestamp, record",
+			record: map[string]interface{}{"a": "b"},
+		},
+		{
+			name:   "unchanged",
+			body:   `record["a"] = "changed"; return 0, timestamp, record`,
+			record: map[string]interface{}{"a": "b"},
+			want:   map[string]interface{}{"a": "b"},
+			time:   ts,
+		},
+		{
+			name:   "record and timestamp",
+			body:   `record["tag"] = tag; return 1, timestamp + 1.5, record`,
+			record: map[string]interface{}{"a": "b"},
+			want:   map[string]interface{}{"a": "b", "tag": "app"},
+			time:   ts.Add(1500 * time.Millisecond),
+		},
+		{
+			name: "record only",
+			body: `record["n"] = record["n"] + 1; record["half"] = record["n"] / 4; return 2, 0, record`,
+			record: map[string]interface{}{
+				"n": int64(1), "ok": true,
+				"nested": map[string]interface{}{"list": []interface{}{"x", int64(2)}},
+			},
+			want: map[string]interface{}{
+				"n": int64(2), "half": 0.5, "ok": true,
+				"nested": map[string]interface{}{"list": []interface{}{"x", int64(2)}},
+			},
+			time: ts,
+		},
+		{
+			name:   "split into records",
+			body:   `return 2, timestamp, {{part = 1}, {part = 2}}`,
+			record: map[string]interface{}{"a": "b"},
+			split:  []map[string]interface{}{{"part": int64(1)}, {"part": int64(2)}},
+		},
+		{
+			name:   "runtime error",
+			body:   `error("boom")`,
+			record: map[string]interface{}{"a": "b"},
+			want:   map[string]interface{}{"a": "b"},
+			time:   ts,
+		},
+		{
+			name:   "invalid code",
+			body:   "return 5, timestamp, record",
+			record: map[string]interface{}{"a": "b"},
+			want:   map[string]interface{}{"a": "b"},
+			time:   ts,
+		},
+		{
+			name:   "record is not a table",
+			body:   `return 2, timestamp, "x"`,
+			record: map[string]interface{}{"a": "b"},
+			want:   map[string]interface{}{"a": "b"},
+			time:   ts,
+		},
+		{
+			name:    "timeout",
+			body:    "while true do end",
+			timeout: 50 * time.Millisecond,
+			record:  map[string]interface{}{"a": "b"},
+			want:    map[string]interface{}{"a": "b"},
+			time:    ts,
+		},
+		{
+			name:   "no os library",
+			body:   `os.execute("true"); return -1, timestamp, record`,
+			record: map[string]interface{}{"a": "b"},
+			want:   map[string]interface{}{"a": "b"},
+			time:   ts,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := NewQueue(10)
+			s, err := NewScriptFilter(NewQueue(1), out, "**", ScriptOptions{
+				Source:  "function filter(tag, timestamp, record)\n" + tt.body + "\nend",
+				Timeout: tt.timeout,
+			})
+			if err != nil {
+				t.Fatalf("NewScriptFilter: %v", err)
+			}
+			defer s.Stop()
+
+			event := NewEvent("app", tt.record)
+			event.Timestamp = ts
+			got := s.Filter(event)
+			switch {
+			case tt.want == nil && got != nil:
+				t.Fatalf("Filter = %v, want nil", got.Record)
+			case tt.want != nil && got == nil:
+				t.Fatal("Filter dropped the event")
+			case tt.want != nil:
+				if !reflect.DeepEqual(got.Record, tt.want) {
+					t.Errorf("record = %#v, want %#v", got.Record, tt.want)
+				}
+				if !got.Timestamp.Equal(tt.time) {
+					t.Errorf("timestamp = %v, want %v", got.Timestamp, tt.time)
+				}
+			}
+
+			var split []map[string]interface{}
+			for {
+				event, ok := out.Get()
+				if !ok {
+					break
+				}
+				split = append(split, event.Record)
+			}
+			if !reflect.DeepEqual(split, tt.split) {
+				t.Errorf("split records = %v, want %v", split, tt.split)
+			}
+		})
+	}
+}
+
+func TestNewScriptFilterErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts ScriptOptions
+	}{
+		{"no script", ScriptOptions{}},
+		{"path and source", ScriptOptions{Path: "filter.lua", Source: "x = 1"}},
+		{"syntax error", ScriptOptions{Source: "function filter("}},
+		{"runtime error", ScriptOptions{Source: `error("boom")`}},
+		{"missing function", ScriptOptions{Source: "function other() end"}},
+		{"missing call", ScriptOptions{Source: "function filter() end", Call: "process"}},
+		{"missing file", ScriptOptions{Path: filepath.Join(t.TempDir(), "missing.lua")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewScriptFilter(NewQueue(1), NewQueue(1), "**", tt.opts); err == nil {
+				t.Error("want error")
+			}
+		})
+	}
+}
+
+func TestScriptFilterReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.lua")
+	write := func(value string) {
+		t.Helper()
+		source := "function process(tag, timestamp, record)\nrecord[\"v\"] = \"" + value + "\"\nreturn 2, timestamp, record\nend"
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("1")
+	s, err := NewScriptFilter(NewQueue(1), NewQueue(1), "**", ScriptOptions{Path: path, Call: "process"})
+	if err != nil {
+		t.Fatalf("NewScriptFilter: %v", err)
+	}
+	defer s.Stop()
+	version := func() interface{} {
+		return s.Filter(NewEvent("app", map[string]interface{}{})).Record["v"]
+	}
+
+	if got := version(); got != "1" {
+		t.Fatalf("v = %v, want 1", got)
+	}
+	write("2")
+	s.reload()
+	if got := version(); got != "2" {
+		t.Errorf("v after reload = %v, want 2", got)
+	}
+	// 新脚本无法编译时继续使用原来的脚本
+	if err := os.WriteFile(path, []byte("function process("), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s.reload()
+	if got := version(); got != "2" {
+		t.Errorf("v after a broken reload = %v, want 2", got)
+	}
+}
+
+func TestScriptFilterStopWithRewrittenEvents(t *testing.T) {
+	testStopPipeline(t, func(in, out *Queue) FilterPlugin {
+		s, err := NewScriptFilter(in, out, "rewritten", ScriptOptions{Source: `
+function filter(tag, timestamp, record)
+    record["script"] = tag
+    return 2, timestamp, record
+end`})
+		if err != nil {
+			t.Fatalf("NewScriptFilter: %v", err)
+		}
+		startWithoutLoop(s.BaseFilter, s.Filter)
+		return s
+	}, map[string]interface{}{"level": "ERROR"}, func(event *Event) bool {
+		return event.Record["script"] == "rewritten"
+	})
+}
+
+func TestScriptFilterAfterStop(t *testing.T) {
+	s, err := NewScriptFilter(NewQueue(1), NewQueue(1), "**", ScriptOptions{Source: `
+function filter(tag, timestamp, record)
+    return -1, timestamp, record
+end`})
+	if err != nil {
+		t.Fatalf("NewScriptFilter: %v", err)
+	}
+	s.Start()
+	s.Stop()
+	if event := s.Filter(NewEvent("app", map[string]interface{}{"message": "hello"})); event == nil || event.Record["message"] != "hello" {
+		t.Errorf("Filter after Stop = %v, want the event unchanged", event)
+	}
+}
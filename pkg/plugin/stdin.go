@@ -0,0 +1,88 @@
+package plugin
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"os"
+	"sync/atomic"
+)
+
+// StdinInput 从标准输入按行解析事件，读到 EOF 时调用 onEOF，
+// 用于 cat old.log | fluentd-go 这样的一次性管道
+type StdinInput struct {
+	*BaseInput
+	reader io.Reader
+	parser Parser
+	onEOF  func()
+	// parseErrors 解析失败被跳过的行数
+	parseErrors atomic.Int64
+}
+
+// NewStdinInput 创建一个新的标准输入插件
+func NewStdinInput(tag string, outputQueue *Queue, parser Parser, onEOF func()) *StdinInput {
+	return &StdinInput{
+		BaseInput: NewBaseInput(tag, outputQueue),
+		reader:    os.Stdin,
+		parser:    parser,
+		onEOF:     onEOF,
+	}
+}
+
+func (s *StdinInput) read() {
+	scanner := bufio.NewScanner(s.reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() && s.IsRunning() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		record, t, err := s.parser.Parse(line)
+		if err != nil {
+			log.Printf("Error parsing stdin line: %v", err)
+			s.parseErrors.Add(1)
+			continue
+		}
+		event := NewEvent(s.tag, record)
+		if !t.IsZero() {
+			event.Timestamp = t
+		}
+		s.inject(event, "", "")
+		// 一次性管道不能丢事件，队列满时等待下游消费
+		s.outputQueue.putWait(event, s.IsRunning)
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Printf("Error reading stdin: %v", err)
+	}
+	if s.IsRunning() && s.onEOF != nil {
+		log.Println("StdinInput reached EOF")
+		s.onEOF()
+	}
+}
+
+// ParseErrors 返回解析失败被跳过的行数
+func (s *StdinInput) ParseErrors() int64 {
+	return s.parseErrors.Load()
+}
+
+func (s *StdinInput) Start() {
+	if s.IsRunning() {
+		return
+	}
+
+	s.SetRunning(true)
+	log.Printf("Starting StdinInput with tag %s", s.tag)
+
+	// 读取标准输入会一直阻塞，无法被中断，所以不加入 wg，Stop 时不等待它退出
+	go s.read()
+}
+
+func (s *StdinInput) Stop() {
+	if !s.IsRunning() {
+		return
+	}
+
+	s.SetRunning(false)
+	log.Println("Stopped StdinInput")
+}
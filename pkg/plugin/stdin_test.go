@@ -0,0 +1,35 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStdinInputParseErrors(t *testing.T) {
+	parser, err := NewParser(ParserOptions{Format: "json"})
+	if err != nil {
+		t.Fatalf("NewParser: %v", err)
+	}
+	out := NewQueue(10)
+	eof := make(chan struct{})
+	s := NewStdinInput("stdin", out, parser, func() { close(eof) })
+	s.reader = strings.NewReader("{\"n\": 1}\nnot json\n\n[1, 2]\n{\"n\": 2}\n")
+
+	fluent := NewFluentd()
+	fluent.AddInput(s)
+	fluent.Start()
+	select {
+	case <-eof:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for EOF")
+	}
+	fluent.Stop()
+
+	if n := out.Len(); n != 2 {
+		t.Errorf("parsed %d events, want 2", n)
+	}
+	if n := fluent.ParseErrors(); n != 2 {
+		t.Errorf("ParseErrors = %d, want 2", n)
+	}
+}
@@ -0,0 +1,165 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+)
+
+// valueTemplate 编译后的字段值模板。字符串中的 ${...} 为表达式占位符，
+// 整个字符串只有一个占位符时保留表达式结果的类型，否则拼接为字符串；
+// map 和数组中的字符串递归处理，其他类型原样输出
+type valueTemplate struct {
+	literal interface{}
+	parts   []templatePart
+	single  bool
+	fields  map[string]*valueTemplate
+	items   []*valueTemplate
+}
+
+type templatePart struct {
+	text string
+	expr *Expression
+}
+
+func compileValueTemplate(value interface{}, variables []string) (*valueTemplate, error) {
+	switch v := value.(type) {
+	case string:
+		parts, err := compileTemplateString(v, variables)
+		if err != nil {
+			return nil, err
+		}
+		return &valueTemplate{parts: parts, single: len(parts) == 1 && parts[0].expr != nil}, nil
+	case map[string]interface{}:
+		t := &valueTemplate{fields: make(map[string]*valueTemplate, len(v))}
+		for key, item := range v {
+			compiled, err := compileValueTemplate(item, variables)
+			if err != nil {
+				return nil, err
+			}
+			t.fields[key] = compiled
+		}
+		return t, nil
+	case []interface{}:
+		t := &valueTemplate{items: make([]*valueTemplate, 0, len(v))}
+		for _, item := range v {
+			compiled, err := compileValueTemplate(item, variables)
+			if err != nil {
+				return nil, err
+			}
+			t.items = append(t.items, compiled)
+		}
+		return t, nil
+	}
+	return &valueTemplate{literal: value}, nil
+}
+
+func (t *valueTemplate) render(vars map[string]interface{}) (interface{}, error) {
+	switch {
+	case t.fields != nil:
+		result := make(map[string]interface{}, len(t.fields))
+		for key, field := range t.fields {
+			value, err := field.render(vars)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = value
+		}
+		return result, nil
+	case t.items != nil:
+		result := make([]interface{}, len(t.items))
+		for i, item := range t.items {
+			value, err := item.render(vars)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = value
+		}
+		return result, nil
+	case t.parts == nil:
+		return t.literal, nil
+	case t.single:
+		return t.parts[0].expr.Eval(vars)
+	}
+
+	var b strings.Builder
+	for _, part := range t.parts {
+		if part.expr == nil {
+			b.WriteString(part.text)
+			continue
+		}
+		value, err := part.expr.Eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(toString(value))
+	}
+	return b.String(), nil
+}
+
+// compileTemplateString 拆分字符串中的文本和 ${...} 占位符，占位符内的字符串字面量可以包含 }
+func compileTemplateString(s string, variables []string) ([]templatePart, error) {
+	parts := []templatePart{}
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			break
+		}
+		end := findPlaceholderEnd(s, start+2)
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed placeholder in %q", s)
+		}
+		expr, err := CompileExpression(s[start+2:end], variables)
+		if err != nil {
+			return nil, fmt.Errorf("placeholder %q: %v", s[start:end+1], err)
+		}
+		if start > 0 {
+			parts = append(parts, templatePart{text: s[:start]})
+		}
+		parts = append(parts, templatePart{expr: expr})
+		s = s[end+1:]
+	}
+	if s != "" {
+		parts = append(parts, templatePart{text: s})
+	}
+	return parts, nil
+}
+
+func findPlaceholderEnd(s string, from int) int {
+	var quote byte
+	for i := from; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '}':
+			return i
+		}
+	}
+	return -1
+}
+
+// tagVariables 返回标签相关的变量：对于 a.b.c，
+// tag_parts 为 [a b c]，tag_prefix 为 [a a.b a.b.c]，tag_suffix 为 [a.b.c b.c c]
+func tagVariables(tag string) map[string]interface{} {
+	parts := strings.Split(tag, ".")
+	tagParts := make([]interface{}, len(parts))
+	prefix := make([]interface{}, len(parts))
+	suffix := make([]interface{}, len(parts))
+	for i, part := range parts {
+		tagParts[i] = part
+		prefix[i] = strings.Join(parts[:i+1], ".")
+		suffix[i] = strings.Join(parts[i:], ".")
+	}
+	return map[string]interface{}{
+		"tag":        tag,
+		"tag_parts":  tagParts,
+		"tag_prefix": prefix,
+		"tag_suffix": suffix,
+	}
+}
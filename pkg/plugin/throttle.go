@@ -0,0 +1,257 @@
+package plugin
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultThrottleSummaryTag 限流开始和结束时发出的汇总事件的标签
+	DefaultThrottleSummaryTag = "fluentd.throttle"
+	// DefaultThrottleMaxGroups 默认最多记录的分组数
+	DefaultThrottleMaxGroups = 10000
+)
+
+// ThrottleOptions throttle 过滤插件的配置
+type ThrottleOptions struct {
+	// GroupKeys 分组字段，支持 record accessor 语法，为空时所有事件属于同一组
+	GroupKeys []string
+	// RateLimit 每个分组在一个时间窗口内最多放行的事件数
+	RateLimit int
+	// Window 时间窗口，默认 60 秒
+	Window time.Duration
+	// Action 超过限制的事件的处理方式：drop (默认) 丢弃，route 改为 RouteTag 后继续传递
+	Action   string
+	RouteTag string
+	// SummaryTag 汇总事件的标签，默认为 DefaultThrottleSummaryTag
+	SummaryTag string
+	// MaxGroups 最多记录的分组数，超过时淘汰最久没有事件的分组
+	MaxGroups int
+	// GroupTTL 分组多久没有事件后被清理，默认为 10 个时间窗口
+	GroupTTL time.Duration
+}
+
+// ThrottleFilter 按分组限制事件速率。分组第一次超过限制时发出 status 为 throttled 的汇总事件，
+// 之后某个时间窗口内没有再超过限制时发出 status 为 resumed 的汇总事件，带上期间被限流的事件数
+type ThrottleFilter struct {
+	*BaseFilter
+	groupKeys  []*RecordAccessor
+	rateLimit  int
+	window     time.Duration
+	route      bool
+	routeTag   string
+	summaryTag string
+	groupTTL   time.Duration
+
+	groupsMu sync.Mutex
+	groups   *lruCache[string, *throttleGroup]
+	stop     chan struct{}
+}
+
+type throttleGroup struct {
+	values      map[string]interface{}
+	windowStart time.Time
+	lastSeen    time.Time
+	count       int
+	exceeded    bool
+	throttled   bool
+	since       time.Time
+	limited     int64
+}
+
+// NewThrottleFilter 创建一个新的限流过滤插件
+func NewThrottleFilter(inputQueue, outputQueue *Queue, matchTag string, opts ThrottleOptions) (*ThrottleFilter, error) {
+	if opts.RateLimit <= 0 {
+		return nil, fmt.Errorf("throttle filter requires a positive rate_limit")
+	}
+	if opts.Window <= 0 {
+		opts.Window = time.Minute
+	}
+	if opts.SummaryTag == "" {
+		opts.SummaryTag = DefaultThrottleSummaryTag
+	}
+	if opts.MaxGroups <= 0 {
+		opts.MaxGroups = DefaultThrottleMaxGroups
+	}
+	if opts.GroupTTL <= 0 {
+		opts.GroupTTL = 10 * opts.Window
+	}
+
+	t := &ThrottleFilter{
+		BaseFilter: NewBaseFilter(inputQueue, outputQueue, matchTag),
+		rateLimit:  opts.RateLimit,
+		window:     opts.Window,
+		summaryTag: opts.SummaryTag,
+		groupTTL:   opts.GroupTTL,
+		groups:     newLRUCache[string, *throttleGroup](opts.MaxGroups),
+	}
+	switch opts.Action {
+	case "", "drop":
+	case "route":
+		if opts.RouteTag == "" {
+			return nil, fmt.Errorf("throttle action route requires a route_tag")
+		}
+		t.route, t.routeTag = true, opts.RouteTag
+	default:
+		return nil, fmt.Errorf("unknown throttle action %q", opts.Action)
+	}
+	for _, key := range opts.GroupKeys {
+		accessor, err := NewRecordAccessor(key)
+		if err != nil {
+			return nil, err
+		}
+		t.groupKeys = append(t.groupKeys, accessor)
+	}
+	return t, nil
+}
+
+// groupOf 返回事件所属分组的 key 和字段值
+func (t *ThrottleFilter) groupOf(record map[string]interface{}) (string, map[string]interface{}) {
+	values := make(map[string]interface{}, len(t.groupKeys))
+	parts := make([]string, len(t.groupKeys))
+	for i, key := range t.groupKeys {
+		value, _ := key.Get(record)
+		values[key.String()] = value
+		parts[i] = toString(value)
+	}
+	return strings.Join(parts, "\x00"), values
+}
+
+// Filter 执行过滤操作
+func (t *ThrottleFilter) Filter(event *Event) *Event {
+	key, values := t.groupOf(event.Record)
+	now := time.Now()
+
+	t.groupsMu.Lock()
+	group, ok := t.groups.Get(key)
+	if !ok {
+		group = &throttleGroup{values: values, windowStart: now}
+		if _, evicted, ok := t.groups.Add(key, group); ok {
+			t.resume(evicted, now)
+		}
+	}
+	t.rollWindow(group, now)
+	group.lastSeen = now
+	group.count++
+
+	allowed := group.count <= t.rateLimit
+	if !allowed {
+		group.exceeded = true
+		group.limited++
+		if !group.throttled {
+			group.throttled, group.since = true, now
+			t.emitSummary(group, "throttled", now)
+		}
+	}
+	t.groupsMu.Unlock()
+
+	switch {
+	case allowed:
+		return event
+	case t.route:
+		event.Tag = t.routeTag
+		return event
+	}
+	return nil
+}
+
+// rollWindow 时间窗口结束时开始新窗口，刚结束的窗口没有超过限制时结束限流
+func (t *ThrottleFilter) rollWindow(group *throttleGroup, now time.Time) {
+	if now.Sub(group.windowStart) < t.window {
+		return
+	}
+	if !group.exceeded {
+		t.resume(group, now)
+	}
+	group.windowStart = now
+	group.count = 0
+	group.exceeded = false
+}
+
+// resume 结束分组的限流状态并发出汇总事件
+func (t *ThrottleFilter) resume(group *throttleGroup, now time.Time) {
+	if !group.throttled {
+		return
+	}
+	t.emitSummary(group, "resumed", now)
+	group.throttled = false
+	group.limited = 0
+}
+
+func (t *ThrottleFilter) emitSummary(group *throttleGroup, status string, now time.Time) {
+	record := map[string]interface{}{
+		"group":          group.values,
+		"status":         status,
+		"rate_limit":     t.rateLimit,
+		"window_seconds": t.window.Seconds(),
+	}
+	if status == "resumed" {
+		record["throttled_events"] = group.limited
+		record["duration_seconds"] = now.Sub(group.since).Seconds()
+		log.Printf("Throttle for group %v resumed after %d events were throttled", group.values, group.limited)
+	} else {
+		log.Printf("Throttling group %v: more than %d events in %s", group.values, t.rateLimit, t.window)
+	}
+	if !t.outputQueue.Put(NewEvent(t.summaryTag, record)) {
+		log.Printf("Dropped throttle summary event because the queue was full")
+	}
+}
+
+// sweep 结束已经恢复的分组的限流状态，并清理长时间没有事件的分组
+func (t *ThrottleFilter) sweep() {
+	now := time.Now()
+
+	t.groupsMu.Lock()
+	defer t.groupsMu.Unlock()
+
+	t.groups.Each(func(_ string, group *throttleGroup) bool {
+		if group.throttled {
+			t.rollWindow(group, now)
+		}
+		return true
+	})
+	for {
+		key, group, ok := t.groups.Oldest()
+		if !ok || now.Sub(group.lastSeen) < t.groupTTL {
+			break
+		}
+		t.resume(group, now)
+		t.groups.Remove(key)
+	}
+}
+
+// Start 启动过滤插件
+func (t *ThrottleFilter) Start() {
+	if t.IsRunning() {
+		return
+	}
+	t.stop = make(chan struct{})
+	t.startLoop("ThrottleFilter", t.Filter)
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		ticker := time.NewTicker(t.window)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-t.stop:
+				return
+			case <-ticker.C:
+				t.sweep()
+			}
+		}
+	}()
+}
+
+// Stop 停止过滤插件
+func (t *ThrottleFilter) Stop() {
+	if !t.IsRunning() {
+		return
+	}
+	close(t.stop)
+	t.stopLoop("ThrottleFilter")
+}
@@ -0,0 +1,250 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TypeConverter 按声明的类型转换记录中的字段。类型的写法：
+//
+//	integer         整数，也接受没有小数部分的浮点数
+//	float           浮点数
+//	bool            true/false、yes/no、on/off、1/0
+//	string          字符串
+//	time[:format]   时间，format 与 time_format 相同 (可以是 strptime 格式)，默认为 RFC3339
+//	array[:sep]     按 sep (默认为逗号) 拆分字符串为数组
+type TypeConverter struct {
+	fields []typedField
+}
+
+type typedField struct {
+	key     *RecordAccessor
+	convert func(interface{}) (interface{}, error)
+}
+
+// NewTypeConverter 编译类型声明，key 支持 record accessor 语法
+func NewTypeConverter(types map[string]string) (*TypeConverter, error) {
+	keys := make([]string, 0, len(types))
+	for key := range types {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	c := &TypeConverter{}
+	for _, key := range keys {
+		accessor, err := NewRecordAccessor(key)
+		if err != nil {
+			return nil, err
+		}
+		convert, err := newTypeConversion(types[key])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", key, err)
+		}
+		c.fields = append(c.fields, typedField{key: accessor, convert: convert})
+	}
+	return c, nil
+}
+
+func newTypeConversion(spec string) (func(interface{}) (interface{}, error), error) {
+	name, arg, _ := strings.Cut(spec, ":")
+	switch strings.TrimSpace(name) {
+	case "integer", "int":
+		return toInteger, nil
+	case "float":
+		return func(v interface{}) (interface{}, error) {
+			if f, ok := toNumber(v); ok {
+				return f, nil
+			}
+			return nil, fmt.Errorf("invalid float %v", v)
+		}, nil
+	case "bool", "boolean":
+		return toBool, nil
+	case "string":
+		return func(v interface{}) (interface{}, error) { return toString(v), nil }, nil
+	case "time":
+		return func(v interface{}) (interface{}, error) {
+			if t, ok := v.(time.Time); ok {
+				return t, nil
+			}
+			return parseEventTime(v, arg, nil)
+		}, nil
+	case "array":
+		sep := arg
+		if sep == "" {
+			sep = ","
+		}
+		return func(v interface{}) (interface{}, error) {
+			switch v := v.(type) {
+			case []interface{}:
+				return v, nil
+			case string:
+				if v == "" {
+					return []interface{}{}, nil
+				}
+				parts := strings.Split(v, sep)
+				list := make([]interface{}, len(parts))
+				for i, part := range parts {
+					list[i] = strings.TrimSpace(part)
+				}
+				return list, nil
+			}
+			return nil, fmt.Errorf("invalid array %v", v)
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown type %q", spec)
+}
+
+func toInteger(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case json.Number:
+		return toInteger(v.String())
+	case string:
+		s := strings.TrimSpace(v)
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, nil
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return toInteger(f)
+		}
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+			return int64(v), nil
+		}
+	}
+	return nil, fmt.Errorf("invalid integer %v", value)
+}
+
+func toBool(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "true", "yes", "on", "1", "t", "y":
+			return true, nil
+		case "false", "no", "off", "0", "f", "n":
+			return false, nil
+		}
+	default:
+		if n, ok := toNumber(v); ok && (n == 0 || n == 1) {
+			return n == 1, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid bool %v", value)
+}
+
+// Convert 转换记录中存在的字段，返回转换失败的字段。nullOnError 为 true 时
+// 转换失败的字段设为 null，否则保留原值
+func (c *TypeConverter) Convert(record map[string]interface{}, nullOnError bool) []string {
+	var failed []string
+	for _, field := range c.fields {
+		value, ok := field.key.Get(record)
+		if !ok || value == nil {
+			continue
+		}
+		converted, err := field.convert(value)
+		if err != nil {
+			failed = append(failed, field.key.String())
+			if !nullOnError {
+				continue
+			}
+			converted = nil
+		}
+		field.key.Set(record, converted)
+	}
+	return failed
+}
+
+// typedParser 在解析结果上应用类型转换，转换失败的字段保留原值
+type typedParser struct {
+	Parser
+	types *TypeConverter
+}
+
+func (p *typedParser) Parse(text string) (map[string]interface{}, time.Time, error) {
+	record, t, err := p.Parser.Parse(text)
+	if err == nil {
+		p.types.Convert(record, false)
+	}
+	return record, t, err
+}
+
+// TypesOptions types 过滤插件的配置
+type TypesOptions struct {
+	// Types 字段和类型，类型的写法见 TypeConverter
+	Types map[string]string
+	// OnError 转换失败时的处理方式：keep (默认) 保留原值，null 设为 null，
+	// drop 丢弃事件，route 保留原值并把事件的标签改为 ErrorTag
+	OnError  string
+	ErrorTag string
+}
+
+// TypesFilter 按声明的类型转换记录中的字段
+type TypesFilter struct {
+	*BaseFilter
+	types    *TypeConverter
+	onError  string
+	errorTag string
+}
+
+// NewTypesFilter 创建一个新的类型转换过滤插件
+func NewTypesFilter(inputQueue, outputQueue *Queue, matchTag string, opts TypesOptions) (*TypesFilter, error) {
+	if len(opts.Types) == 0 {
+		return nil, fmt.Errorf("types filter requires at least one type")
+	}
+	types, err := NewTypeConverter(opts.Types)
+	if err != nil {
+		return nil, err
+	}
+	switch opts.OnError {
+	case "":
+		opts.OnError = "keep"
+	case "keep", "null", "drop":
+	case "route":
+		if opts.ErrorTag == "" {
+			return nil, fmt.Errorf("types on_error route requires an error_tag")
+		}
+	default:
+		return nil, fmt.Errorf("unknown on_error policy %q", opts.OnError)
+	}
+	return &TypesFilter{
+		BaseFilter: NewBaseFilter(inputQueue, outputQueue, matchTag),
+		types:      types,
+		onError:    opts.OnError,
+		errorTag:   opts.ErrorTag,
+	}, nil
+}
+
+// Filter 执行过滤操作
+func (t *TypesFilter) Filter(event *Event) *Event {
+	failed := t.types.Convert(event.Record, t.onError == "null")
+	if len(failed) == 0 {
+		return event
+	}
+	switch t.onError {
+	case "drop":
+		return nil
+	case "route":
+		event.Tag = t.errorTag
+	}
+	return event
+}
+
+// Start 启动过滤插件
+func (t *TypesFilter) Start() {
+	t.startLoop("TypesFilter", t.Filter)
+}
+
+// Stop 停止过滤插件
+func (t *TypesFilter) Stop() {
+	t.stopLoop("TypesFilter")
+}
@@ -0,0 +1,200 @@
+package plugin
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ua-parser/uap-go/uaparser"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultUAParserCacheSize ua_parser 过滤插件默认缓存的 User-Agent 数量
+const DefaultUAParserCacheSize = 10000
+
+// DefaultUAParserTarget 解析结果默认写入的字段
+const DefaultUAParserTarget = "ua"
+
+// UAParserOptions ua_parser 过滤插件的配置
+type UAParserOptions struct {
+	// Key 要解析的 User-Agent 字段，支持 record accessor 语法
+	Key string
+	// Target 解析结果写入的字段，默认为 ua
+	Target string
+	// RegexesPath uap-core 格式的 regexes.yaml，为空时使用内置的规则
+	RegexesPath string
+	// CacheSize 缓存解析结果的 User-Agent 数量
+	CacheSize int
+	// DeleteKey 为 true 时解析后删除原字段
+	DeleteKey bool
+}
+
+// UAParserFilter 使用 uap-core 的规则解析 User-Agent，写入如下结构：
+//
+//	{browser: {family, major, minor, patch, version}, os: {family, major, minor, patch, version},
+//	 device: {family, brand, model, category}}
+//
+// 为空的字段不写入。category 根据解析结果推断，取值为 bot、tablet、mobile、desktop 或 other
+type UAParserFilter struct {
+	*BaseFilter
+	key       *RecordAccessor
+	target    *RecordAccessor
+	deleteKey bool
+	parser    *uaparser.Parser
+	cache     *lruCache[string, map[string]interface{}]
+}
+
+// NewUAParserFilter 创建一个新的 User-Agent 解析过滤插件，规则文件无法加载时返回错误
+func NewUAParserFilter(inputQueue, outputQueue *Queue, matchTag string, opts UAParserOptions) (*UAParserFilter, error) {
+	if opts.Key == "" {
+		return nil, fmt.Errorf("ua_parser filter requires a key")
+	}
+	if opts.Target == "" {
+		opts.Target = DefaultUAParserTarget
+	}
+	if opts.CacheSize <= 0 {
+		opts.CacheSize = DefaultUAParserCacheSize
+	}
+
+	key, err := NewRecordAccessor(opts.Key)
+	if err != nil {
+		return nil, err
+	}
+	target, err := NewRecordAccessor(opts.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	// 结果由插件自己的 LRU 缓存，uap-go 内部的缓存只保留最小容量
+	parserOpts := []uaparser.Option{uaparser.WithCacheSize(1)}
+	if opts.RegexesPath != "" {
+		data, err := os.ReadFile(opts.RegexesPath)
+		if err != nil {
+			return nil, err
+		}
+		var definitions uaparser.RegexDefinitions
+		if err := yaml.Unmarshal(data, &definitions); err != nil {
+			return nil, fmt.Errorf("parse %s: %v", opts.RegexesPath, err)
+		}
+		parserOpts = append(parserOpts, uaparser.WithRegexDefinitions(definitions))
+	}
+	parser, err := uaparser.New(parserOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UAParserFilter{
+		BaseFilter: NewBaseFilter(inputQueue, outputQueue, matchTag),
+		key:        key,
+		target:     target,
+		deleteKey:  opts.DeleteKey,
+		parser:     parser,
+		cache:      newLRUCache[string, map[string]interface{}](opts.CacheSize),
+	}, nil
+}
+
+// parse 解析 User-Agent，返回的结果是缓存中的对象，调用方不能修改
+func (u *UAParserFilter) parse(userAgent string) map[string]interface{} {
+	if result, ok := u.cache.Get(userAgent); ok {
+		return result
+	}
+
+	client := u.parser.Parse(userAgent)
+	browser := uaVersionFields(client.UserAgent.Family, client.UserAgent.Major, client.UserAgent.Minor, client.UserAgent.Patch)
+	osFields := uaVersionFields(client.Os.Family, client.Os.Major, client.Os.Minor, client.Os.Patch)
+	device := map[string]interface{}{
+		"category": uaDeviceCategory(userAgent, client),
+	}
+	setNonEmpty(device, "family", client.Device.Family)
+	setNonEmpty(device, "brand", client.Device.Brand)
+	setNonEmpty(device, "model", client.Device.Model)
+
+	result := map[string]interface{}{
+		"browser": browser,
+		"os":      osFields,
+		"device":  device,
+	}
+	u.cache.Add(userAgent, result)
+	return result
+}
+
+func uaVersionFields(family, major, minor, patch string) map[string]interface{} {
+	fields := make(map[string]interface{})
+	setNonEmpty(fields, "family", family)
+	setNonEmpty(fields, "major", major)
+	setNonEmpty(fields, "minor", minor)
+	setNonEmpty(fields, "patch", patch)
+
+	var parts []string
+	for _, part := range []string{major, minor, patch} {
+		if part == "" {
+			break
+		}
+		parts = append(parts, part)
+	}
+	setNonEmpty(fields, "version", strings.Join(parts, "."))
+	return fields
+}
+
+func setNonEmpty(fields map[string]interface{}, key, value string) {
+	if value != "" {
+		fields[key] = value
+	}
+}
+
+var (
+	uaMobileOS  = []string{"iOS", "Android", "Windows Phone", "BlackBerry OS", "KaiOS", "Symbian OS", "Firefox OS"}
+	uaDesktopOS = []string{"Windows", "Mac OS X", "Linux", "Ubuntu", "Fedora", "Debian", "Chrome OS", "FreeBSD", "OpenBSD", "NetBSD", "Solaris"}
+)
+
+// uaDeviceCategory 根据解析结果推断设备类型，uap-core 本身不提供这个信息
+func uaDeviceCategory(userAgent string, client *uaparser.Client) string {
+	if client.Device.Family == "Spider" {
+		return "bot"
+	}
+	family := client.Device.Family
+	if strings.Contains(userAgent, "iPad") || strings.Contains(userAgent, "Tablet") ||
+		strings.Contains(family, "Tablet") || strings.Contains(family, "Kindle") ||
+		(client.Os.Family == "Android" && !strings.Contains(userAgent, "Mobile")) {
+		return "tablet"
+	}
+	if strings.Contains(userAgent, "Mobi") || slices.Contains(uaMobileOS, client.Os.Family) {
+		return "mobile"
+	}
+	if slices.Contains(uaDesktopOS, client.Os.Family) {
+		return "desktop"
+	}
+	return "other"
+}
+
+// Filter 解析 User-Agent 字段，字段不存在或为空时事件原样通过
+func (u *UAParserFilter) Filter(event *Event) *Event {
+	raw, ok := u.key.Get(event.Record)
+	if !ok || raw == nil {
+		return event
+	}
+	userAgent := strings.TrimSpace(toString(raw))
+	if userAgent == "" || userAgent == "-" {
+		return event
+	}
+
+	if u.deleteKey {
+		u.key.Delete(event.Record)
+	}
+	if err := u.target.Set(event.Record, copyValue(u.parse(userAgent))); err != nil {
+		log.Printf("Error setting user agent target %s: %v", u.target, err)
+	}
+	return event
+}
+
+// Start 启动过滤插件
+func (u *UAParserFilter) Start() {
+	u.startLoop("UAParserFilter", u.Filter)
+}
+
+// Stop 停止过滤插件
+func (u *UAParserFilter) Stop() {
+	u.stopLoop("UAParserFilter")
+}
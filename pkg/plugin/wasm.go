@@ -0,0 +1,336 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	// DefaultWasmMemoryLimit 模块默认可以使用的最大内存
+	DefaultWasmMemoryLimit = 16 * 1024 * 1024
+	// DefaultWasmTimeout 模块处理一个事件的默认超时时间
+	DefaultWasmTimeout = time.Second
+
+	wasmPageSize = 64 * 1024
+)
+
+// WasmOptions wasm 过滤插件的配置
+type WasmOptions struct {
+	// Path .wasm 模块文件
+	Path string
+	// Format 事件的编码方式：json (默认) 或 msgpack
+	Format string
+	// MemoryLimit 模块可以使用的最大内存字节数
+	MemoryLimit int
+	// Timeout 处理一个事件的超时时间，超时后模块被重新实例化，事件原样通过
+	Timeout time.Duration
+}
+
+// WasmFilter 用 WebAssembly 模块处理事件，模块运行在沙箱中，只能使用不访问文件和网络的 WASI 接口。
+//
+// 模块需要导出以下函数 (Rust 或 TinyGo 以 reactor/c-shared 方式编译，_initialize 会在实例化时调用)：
+//
+//	memory                          线性内存
+//	alloc(size i32) i32             分配 size 字节，返回地址
+//	filter(ptr i32, len i32) i64    处理一个事件，返回 (结果地址 << 32) | 结果长度
+//	dealloc(ptr i32, size i32)      可选，释放 alloc 分配的内存和 filter 返回的结果
+//
+// 输入是一个编码后的对象 {"tag": string, "time": Unix 纳秒, "record": map}。
+// 结果长度为 0 或结果为 null 时丢弃事件；结果为对象时用其中的 tag、time、record 替换事件的对应字段，
+// 缺少的字段保持不变；结果为对象数组时每个对象作为一个事件发出
+type WasmFilter struct {
+	*BaseFilter
+	path    string
+	msgpack bool
+	timeout time.Duration
+
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	module   api.Module
+	// closed 运行时已经释放，之后的事件无法处理
+	closed bool
+}
+
+// wasmEvent 与模块交换的事件
+type wasmEvent struct {
+	Tag    *string                `json:"tag,omitempty" msgpack:"tag,omitempty"`
+	Time   *int64                 `json:"time,omitempty" msgpack:"time,omitempty"`
+	Record map[string]interface{} `json:"record,omitempty" msgpack:"record,omitempty"`
+}
+
+// NewWasmFilter 创建一个新的 wasm 过滤插件，模块无法编译、实例化或缺少导出函数时返回错误
+func NewWasmFilter(inputQueue, outputQueue *Queue, matchTag string, opts WasmOptions) (*WasmFilter, error) {
+	if opts.Path == "" {
+		return nil, fmt.Errorf("wasm filter requires a path")
+	}
+	if opts.MemoryLimit <= 0 {
+		opts.MemoryLimit = DefaultWasmMemoryLimit
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultWasmTimeout
+	}
+	w := &WasmFilter{
+		BaseFilter: NewBaseFilter(inputQueue, outputQueue, matchTag),
+		path:       opts.Path,
+		timeout:    opts.Timeout,
+	}
+	switch opts.Format {
+	case "", "json":
+	case "msgpack":
+		w.msgpack = true
+	default:
+		return nil, fmt.Errorf("unknown wasm format %q", opts.Format)
+	}
+
+	code, err := os.ReadFile(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	pages := uint32((opts.MemoryLimit + wasmPageSize - 1) / wasmPageSize)
+	w.runtime = wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(pages).
+		WithCloseOnContextDone(true))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, w.runtime); err != nil {
+		w.runtime.Close(ctx)
+		return nil, err
+	}
+	if w.compiled, err = w.runtime.CompileModule(ctx, code); err != nil {
+		w.runtime.Close(ctx)
+		return nil, fmt.Errorf("compile %s: %v", opts.Path, err)
+	}
+	if err := w.instantiate(); err != nil {
+		w.runtime.Close(ctx)
+		return nil, err
+	}
+	return w, nil
+}
+
+// instantiate 创建新的模块实例，模块出错或超时后用它恢复
+func (w *WasmFilter) instantiate() error {
+	ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+	defer cancel()
+
+	module, err := w.runtime.InstantiateModule(ctx, w.compiled, wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize").
+		WithStderr(os.Stderr))
+	if err != nil {
+		return fmt.Errorf("instantiate %s: %v", w.path, err)
+	}
+	for _, name := range []string{"alloc", "filter"} {
+		if module.ExportedFunction(name) == nil {
+			module.Close(context.Background())
+			return fmt.Errorf("%s does not export function %s", w.path, name)
+		}
+	}
+	if module.Memory() == nil {
+		module.Close(context.Background())
+		return fmt.Errorf("%s does not export memory", w.path)
+	}
+	w.module = module
+	return nil
+}
+
+func (w *WasmFilter) encode(event *Event) ([]byte, error) {
+	nanos := event.Timestamp.UnixNano()
+	input := wasmEvent{Tag: &event.Tag, Time: &nanos, Record: event.Record}
+	if w.msgpack {
+		return msgpack.Marshal(&input)
+	}
+	return json.Marshal(&input)
+}
+
+// decode 解码模块的结果，返回 nil 表示丢弃
+func (w *WasmFilter) decode(data []byte) ([]wasmEvent, error) {
+	var result interface{}
+	if w.msgpack {
+		decoder := msgpack.NewDecoder(bytes.NewReader(data))
+		decoder.UseLooseInterfaceDecoding(true)
+		if err := decoder.Decode(&result); err != nil {
+			return nil, err
+		}
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&result); err != nil {
+			return nil, err
+		}
+		result = normalizeJSONNumbers(result)
+	}
+
+	var objects []interface{}
+	switch v := result.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		objects = []interface{}{v}
+	case []interface{}:
+		objects = v
+	default:
+		return nil, fmt.Errorf("unexpected result type %T", result)
+	}
+
+	events := make([]wasmEvent, 0, len(objects))
+	for _, object := range objects {
+		m, ok := object.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unexpected event type %T", object)
+		}
+		var event wasmEvent
+		if tag, ok := m["tag"].(string); ok {
+			event.Tag = &tag
+		}
+		if t, ok := m["time"]; ok {
+			if n, err := toInteger(t); err == nil {
+				nanos := n.(int64)
+				event.Time = &nanos
+			}
+		}
+		if record, ok := m["record"].(map[string]interface{}); ok {
+			event.Record = record
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// call 把输入写入模块内存，调用 filter 并复制结果
+func (w *WasmFilter) call(input []byte) ([]byte, error) {
+	if w.module == nil {
+		if err := w.instantiate(); err != nil {
+			return nil, err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+	defer cancel()
+
+	memory := w.module.Memory()
+	dealloc := w.module.ExportedFunction("dealloc")
+
+	results, err := w.module.ExportedFunction("alloc").Call(ctx, uint64(len(input)))
+	if err != nil {
+		return nil, fmt.Errorf("alloc: %v", err)
+	}
+	ptr := uint32(results[0])
+	if !memory.Write(ptr, input) {
+		return nil, fmt.Errorf("alloc returned out of range pointer %d", ptr)
+	}
+
+	results, err = w.module.ExportedFunction("filter").Call(ctx, uint64(ptr), uint64(len(input)))
+	if err != nil {
+		return nil, fmt.Errorf("filter: %v", err)
+	}
+	if dealloc != nil {
+		dealloc.Call(ctx, uint64(ptr), uint64(len(input)))
+	}
+
+	outPtr, outLen := uint32(results[0]>>32), uint32(results[0])
+	if outLen == 0 {
+		return nil, nil
+	}
+	data, ok := memory.Read(outPtr, outLen)
+	if !ok {
+		return nil, fmt.Errorf("filter returned out of range result %d+%d", outPtr, outLen)
+	}
+	output := bytes.Clone(data)
+	if dealloc != nil {
+		dealloc.Call(ctx, uint64(outPtr), uint64(outLen))
+	}
+	return output, nil
+}
+
+// Filter 执行过滤操作，模块出错或超时时事件原样通过。
+// 运行时释放后事件被丢弃，模块可能负责脱敏，不能让没有处理的事件流到下游
+func (w *WasmFilter) Filter(event *Event) *Event {
+	if w.closed {
+		log.Printf("WasmFilter is stopped, dropping event %s that was not processed by %s", event.Tag, w.path)
+		return nil
+	}
+	input, err := w.encode(event)
+	if err != nil {
+		log.Printf("Error encoding event %s for wasm: %v", event.Tag, err)
+		return event
+	}
+	output, err := w.call(input)
+	if err != nil {
+		log.Printf("Error running wasm module %s for %s: %v", w.path, event.Tag, err)
+		// 出错后实例的状态不可信，下次调用时重新实例化
+		if w.module != nil {
+			w.module.Close(context.Background())
+			w.module = nil
+		}
+		return event
+	}
+	if len(output) == 0 {
+		return nil
+	}
+	events, err := w.decode(output)
+	if err != nil {
+		log.Printf("Error decoding wasm result for %s: %v", event.Tag, err)
+		return event
+	}
+
+	apply := func(target *Event, result wasmEvent) *Event {
+		if result.Tag != nil {
+			target.Tag = *result.Tag
+		}
+		if result.Time != nil {
+			target.Timestamp = time.Unix(0, *result.Time)
+		}
+		if result.Record != nil {
+			target.Record = result.Record
+		}
+		return target
+	}
+	switch len(events) {
+	case 0:
+		return nil
+	case 1:
+		return apply(event, events[0])
+	}
+	for _, result := range events {
+		copied := &Event{Tag: event.Tag, Timestamp: event.Timestamp, Record: event.Record, rewrites: event.rewrites}
+		if result.Record == nil {
+			copied.Record = copyValue(event.Record).(map[string]interface{})
+		}
+		w.put(apply(copied, result))
+	}
+	return nil
+}
+
+// Start 启动过滤插件
+func (w *WasmFilter) Start() {
+	w.startLoop("WasmFilter", w.Filter)
+}
+
+// Stop 停止过滤插件并释放运行时
+func (w *WasmFilter) Stop() {
+	w.halt()
+	w.release()
+}
+
+// halt 停止处理循环，运行时保留到 release
+func (w *WasmFilter) halt() {
+	w.stopLoop("WasmFilter")
+}
+
+// release 释放运行时
+func (w *WasmFilter) release() {
+	if w.closed {
+		return
+	}
+	w.runtime.Close(context.Background())
+	w.module = nil
+	w.closed = true
+}
@@ -0,0 +1,198 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// wasmFilterBody 测试模块中 filter 函数的函数体
+var (
+	// wasmIdentity 原样返回输入：(ptr << 32) | len
+	wasmIdentity = []byte{0x00, 0x20, 0x00, 0xad, 0x42, 0x20, 0x86, 0x20, 0x01, 0xad, 0x84, 0x0b}
+	// wasmDrop 返回长度为 0 的结果，丢弃事件
+	wasmDrop = []byte{0x00, 0x42, 0x00, 0x0b}
+	// wasmTrap 执行 unreachable
+	wasmTrap = []byte{0x00, 0x00, 0x0b}
+	// wasmLoop 死循环
+	wasmLoop = []byte{0x00, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x00, 0x0b}
+)
+
+// writeTestWasmModule 生成一个最小的模块：导出 memory、从 1024 开始顺序分配的 alloc 和给定函数体的 filter
+func writeTestWasmModule(t *testing.T, filterBody []byte) string {
+	t.Helper()
+	section := func(id byte, content ...byte) []byte {
+		return append([]byte{id, byte(len(content))}, content...)
+	}
+	name := func(s string) []byte {
+		return append([]byte{byte(len(s))}, s...)
+	}
+	alloc := []byte{0x00, 0x23, 0x00, 0x23, 0x00, 0x20, 0x00, 0x6a, 0x24, 0x00, 0x0b}
+
+	var exports []byte
+	exports = append(exports, 0x03)
+	exports = append(append(exports, name("memory")...), 0x02, 0x00)
+	exports = append(append(exports, name("alloc")...), 0x00, 0x00)
+	exports = append(append(exports, name("filter")...), 0x00, 0x01)
+
+	var code []byte
+	code = append(code, 0x02, byte(len(alloc)))
+	code = append(code, alloc...)
+	code = append(code, byte(len(filterBody)))
+	code = append(code, filterBody...)
+
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	module = append(module, section(0x01, 0x02, 0x60, 0x01, 0x7f, 0x01, 0x7f, 0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7e)...)
+	module = append(module, section(0x03, 0x02, 0x00, 0x01)...)
+	module = append(module, section(0x05, 0x01, 0x00, 0x01)...)
+	module = append(module, section(0x06, 0x01, 0x7f, 0x01, 0x41, 0x80, 0x08, 0x0b)...)
+	module = append(module, section(0x07, exports...)...)
+	module = append(module, section(0x0a, code...)...)
+
+	path := filepath.Join(t.TempDir(), "filter.wasm")
+	if err := os.WriteFile(path, module, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestWasmFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    []byte
+		format  string
+		timeout time.Duration
+		record  map[string]interface{}
+		// want 为 nil 时期望事件被丢弃
+		want map[string]interface{}
+	}{
+		{
+			name:   "identity json",
+			body:   wasmIdentity,
+			record: map[string]interface{}{"n": 1, "nested": map[string]interface{}{"s": "x"}},
+			want:   map[string]interface{}{"n": int64(1), "nested": map[string]interface{}{"s": "x"}},
+		},
+		{
+			name:   "identity msgpack",
+			body:   wasmIdentity,
+			format: "msgpack",
+			record: map[string]interface{}{"s": "x", "list": []interface{}{"a", "b"}},
+			want:   map[string]interface{}{"s": "x", "list": []interface{}{"a", "b"}},
+		},
+		{
+			name:   "drop",
+			body:   wasmDrop,
+			record: map[string]interface{}{"s": "x"},
+		},
+		{
+			name:   "trap passes the event through",
+			body:   wasmTrap,
+			record: map[string]interface{}{"s": "x"},
+			want:   map[string]interface{}{"s": "x"},
+		},
+		{
+			name:    "timeout passes the event through",
+			body:    wasmLoop,
+			timeout: 50 * time.Millisecond,
+			record:  map[string]interface{}{"s": "x"},
+			want:    map[string]interface{}{"s": "x"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := NewWasmFilter(NewQueue(1), NewQueue(1), "**", WasmOptions{
+				Path:    writeTestWasmModule(t, tt.body),
+				Format:  tt.format,
+				Timeout: tt.timeout,
+			})
+			if err != nil {
+				t.Fatalf("NewWasmFilter: %v", err)
+			}
+			defer w.Stop()
+
+			// 第二次调用检查出错后重新实例化的模块
+			for i := 0; i < 2; i++ {
+				ts := time.Unix(1700000000, 123)
+				event := NewEvent("app", copyValue(tt.record).(map[string]interface{}))
+				event.Timestamp = ts
+				got := w.Filter(event)
+				if tt.want == nil {
+					if got != nil {
+						t.Fatalf("Filter = %v, want the event dropped", got.Record)
+					}
+					continue
+				}
+				if got == nil {
+					t.Fatal("Filter dropped the event")
+				}
+				if !reflect.DeepEqual(got.Record, tt.want) {
+					t.Errorf("record = %#v, want %#v", got.Record, tt.want)
+				}
+				if got.Tag != "app" || !got.Timestamp.Equal(ts) {
+					t.Errorf("tag, time = %s, %v, want app, %v", got.Tag, got.Timestamp, ts)
+				}
+			}
+		})
+	}
+}
+
+func TestNewWasmFilterErrors(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.wasm")
+	empty := filepath.Join(dir, "empty.wasm")
+	if err := os.WriteFile(invalid, []byte("not wasm"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(empty, []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		opts WasmOptions
+	}{
+		{"no path", WasmOptions{}},
+		{"unknown format", WasmOptions{Path: writeTestWasmModule(t, wasmIdentity), Format: "xml"}},
+		{"missing file", WasmOptions{Path: filepath.Join(dir, "missing.wasm")}},
+		{"invalid module", WasmOptions{Path: invalid}},
+		{"missing exports", WasmOptions{Path: empty}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewWasmFilter(NewQueue(1), NewQueue(1), "**", tt.opts); err == nil {
+				t.Error("want error")
+			}
+		})
+	}
+}
+
+func TestWasmFilterStopDoesNotLeakEvents(t *testing.T) {
+	path := writeTestWasmModule(t, wasmDrop)
+	events := runStopPipeline(t, func(in, out *Queue) FilterPlugin {
+		w, err := NewWasmFilter(in, out, "rewritten", WasmOptions{Path: path})
+		if err != nil {
+			t.Fatalf("NewWasmFilter: %v", err)
+		}
+		startWithoutLoop(w.BaseFilter, w.Filter)
+		return w
+	}, map[string]interface{}{"level": "ERROR", "email": "user@example.com"}, 100)
+	if len(events) != 0 {
+		t.Errorf("%d events passed the wasm filter during shutdown, want all dropped by the module", len(events))
+	}
+}
+
+func TestWasmFilterAfterStop(t *testing.T) {
+	w, err := NewWasmFilter(NewQueue(1), NewQueue(1), "**", WasmOptions{Path: writeTestWasmModule(t, wasmIdentity)})
+	if err != nil {
+		t.Fatalf("NewWasmFilter: %v", err)
+	}
+	if event := w.Filter(NewEvent("app", map[string]interface{}{"message": "hello"})); event == nil || event.Record["message"] != "hello" {
+		t.Fatalf("Filter = %v, want the event unchanged", event)
+	}
+	w.Start()
+	w.Stop()
+	if event := w.Filter(NewEvent("app", map[string]interface{}{"message": "hello"})); event != nil {
+		t.Errorf("Filter after Stop = %v, want the event dropped", event)
+	}
+}